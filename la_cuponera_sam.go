@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
@@ -34,6 +35,48 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		},
 		TableName:     jsii.String("LaCuponeraTable"),
 		RemovalPolicy: awscdk.RemovalPolicy_DESTROY,
+		// temporary items (like idempotency keys) are deleted after this date
+		TimeToLiveAttribute: jsii.String("ttl"),
+	})
+
+	// query the coupons of a single category without reading the whole partition.
+	// The entity type is the sort key, since enterprises also have a category
+	table.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("categoryIndex"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("category"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		SortKey: &awsdynamodb.Attribute{
+			Name: jsii.String("entityType"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	// purchase history of a client, sorted by the date in which the offer was bought
+	table.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("userOffersIndex"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("userId"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		SortKey: &awsdynamodb.Attribute{
+			Name: jsii.String("generatedAt"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+	})
+
+	// coupons, sold offers and employees of an enterprise, for the enterprise portal
+	table.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName: jsii.String("enterpriseIndex"),
+		PartitionKey: &awsdynamodb.Attribute{
+			Name: jsii.String("enterpriseCode"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
+		SortKey: &awsdynamodb.Attribute{
+			Name: jsii.String("entityType"),
+			Type: awsdynamodb.AttributeType_STRING,
+		},
 	})
 
 	// generate three lamdbas, one for each type of functionality in the API:
@@ -48,7 +91,14 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		Code:    awslambda.AssetCode_FromAsset(jsii.String("lambda/functions/couponFunction/couponFunction.zip"), nil),
 		Environment: &map[string]*string{
 			"TABLE_NAME": table.TableName(),
-			"SECRET":     jsii.String(os.Getenv("JWT_SECRET_STRING")),
+			// every instance signs the pagination cursors with the same key, so any of them accepts them
+			"CURSOR_SECRET": jsii.String(os.Getenv("CURSOR_SECRET")),
+			// only the public keys: this lambda verifies the tokens, but it can't sign them
+			"JWT_PUBLIC_KEYS": jsii.String(os.Getenv("JWT_PUBLIC_KEYS")),
+			// how long the search index of each instance is used before it is loaded again, like "5m"
+			"SEARCH_INDEX_TTL": jsii.String(os.Getenv("SEARCH_INDEX_TTL")),
+			// this lambda doesn't send emails, but every lambda builds a mailer when it starts
+			"MAIL_PROVIDER": jsii.String("ses"),
 		},
 	})
 
@@ -59,7 +109,15 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		Code:    awslambda.AssetCode_FromAsset(jsii.String("lambda/functions/userFunction/userFunction.zip"), nil),
 		Environment: &map[string]*string{
 			"TABLE_NAME": table.TableName(),
-			"SECRET":     jsii.String(os.Getenv("JWT_SECRET_STRING")),
+			// every instance signs the pagination cursors with the same key, so any of them accepts them
+			"CURSOR_SECRET": jsii.String(os.Getenv("CURSOR_SECRET")),
+			// only the public keys: this lambda verifies the tokens, but it can't sign them
+			"JWT_PUBLIC_KEYS": jsii.String(os.Getenv("JWT_PUBLIC_KEYS")),
+			// the verification email is sent after the registration of a client
+			"MAIL_PROVIDER":          jsii.String("ses"),
+			"MAIL_FROM":              jsii.String(os.Getenv("MAIL_FROM")),
+			"EMAIL_VERIFICATION_URL": jsii.String(os.Getenv("EMAIL_VERIFICATION_URL")),
+			"EMAIL_VERIFICATION_TTL": jsii.String(os.Getenv("EMAIL_VERIFICATION_TTL")),
 		},
 	})
 
@@ -70,7 +128,29 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		Code:    awslambda.AssetCode_FromAsset(jsii.String("lambda/functions/loginFunction/loginFunction.zip"), nil),
 		Environment: &map[string]*string{
 			"TABLE_NAME": table.TableName(),
-			"SECRET":     jsii.String(os.Getenv("JWT_SECRET_STRING")),
+			// every instance signs the pagination cursors with the same key, so any of them accepts them
+			"CURSOR_SECRET": jsii.String(os.Getenv("CURSOR_SECRET")),
+			// only this lambda can sign tokens, see "Signing keys" in the README
+			"JWT_SIGNING_KEY":    jsii.String(os.Getenv("JWT_SIGNING_KEY")),
+			"JWT_SIGNING_KEY_ID": jsii.String(os.Getenv("JWT_SIGNING_KEY_ID")),
+			"JWT_PUBLIC_KEYS":    jsii.String(os.Getenv("JWT_PUBLIC_KEYS")),
+			// the HS256 secret of the first versions, only needed until the end of JWT_HS256_UNTIL
+			"SECRET":          jsii.String(os.Getenv("JWT_SECRET_STRING")),
+			"JWT_HS256_UNTIL": jsii.String(os.Getenv("JWT_HS256_UNTIL")),
+			// lifetime of the sessions, the defaults are 15m and 168h
+			"ACCESS_TOKEN_TTL":  jsii.String(os.Getenv("ACCESS_TOKEN_TTL")),
+			"REFRESH_TOKEN_TTL": jsii.String(os.Getenv("REFRESH_TOKEN_TTL")),
+			// emails of the password reset and the verification, see "Emails" in the README
+			"MAIL_PROVIDER":          jsii.String("ses"),
+			"MAIL_FROM":              jsii.String(os.Getenv("MAIL_FROM")),
+			"PASSWORD_RESET_URL":     jsii.String(os.Getenv("PASSWORD_RESET_URL")),
+			"PASSWORD_RESET_TTL":     jsii.String(os.Getenv("PASSWORD_RESET_TTL")),
+			"EMAIL_VERIFICATION_URL": jsii.String(os.Getenv("EMAIL_VERIFICATION_URL")),
+			"EMAIL_VERIFICATION_TTL": jsii.String(os.Getenv("EMAIL_VERIFICATION_TTL")),
+			// the first administrator is created when the login lambda starts, if these are set
+			"BOOTSTRAP_ADMIN_USERNAME": jsii.String(os.Getenv("BOOTSTRAP_ADMIN_USERNAME")),
+			"BOOTSTRAP_ADMIN_EMAIL":    jsii.String(os.Getenv("BOOTSTRAP_ADMIN_EMAIL")),
+			"BOOTSTRAP_ADMIN_PASSWORD": jsii.String(os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")),
 		},
 	})
 
@@ -78,6 +158,15 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 	table.GrantReadWriteData(usersLambda)
 	table.GrantReadWriteData(loginLambda)
 
+	// the emails are sent through SES, the sender (MAIL_FROM) must be a verified identity
+	sendEmail := awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Actions:   jsii.Strings("ses:SendEmail", "ses:SendRawEmail"),
+		Resources: jsii.Strings("*"),
+	})
+
+	usersLambda.AddToRolePolicy(sendEmail)
+	loginLambda.AddToRolePolicy(sendEmail)
+
 	// Finally, create the integration with the API Gateway
 
 	api := awsapigateway.NewRestApi(stack, jsii.String("LaCuponeraApi"), &awsapigateway.RestApiProps{
@@ -99,6 +188,7 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 				"X-Api-Key",
 				"X-Amz-Securit-Token",
 				"X-Amz-User-Agent",
+				"Idempotency-Key",
 			),
 		},
 		DeployOptions: &awsapigateway.StageOptions{
@@ -130,7 +220,7 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 	couponsResource.AddResource(jsii.String("{couponId}"), nil).
 		AddMethod(jsii.String("GET"), couponsIntegration, nil)
 
-	// PUT /coupons/{id}
+	// PUT /coupons/{couponId}
 	couponsResource.GetResource(jsii.String("{couponId}")).
 		AddMethod(jsii.String("PUT"), couponsIntegration, nil)
 
@@ -140,12 +230,28 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		AddResource(jsii.String("{category}"), nil).
 		AddMethod(jsii.String("GET"), couponsIntegration, nil)
 
+	// search the coupons on sale, with filters and sorting
+	// GET /coupons/search
+	couponsResource.AddResource(jsii.String("search"), nil).
+		AddMethod(jsii.String("GET"), couponsIntegration, nil)
+
 	// buy a coupon
 	// POST /coupons/{id}/buy
 	couponsResource.GetResource(jsii.String("{couponId}")).
 		AddResource(jsii.String("buy"), nil).
 		AddMethod(jsii.String("POST"), couponsIntegration, nil)
 
+	// coupon approval, only for administrators
+	// POST /coupons/{id}/approve
+	couponsResource.GetResource(jsii.String("{couponId}")).
+		AddResource(jsii.String("approve"), nil).
+		AddMethod(jsii.String("POST"), couponsIntegration, nil)
+
+	// POST /coupons/{id}/reject
+	couponsResource.GetResource(jsii.String("{couponId}")).
+		AddResource(jsii.String("reject"), nil).
+		AddMethod(jsii.String("POST"), couponsIntegration, nil)
+
 	// Offers resources
 
 	// since offers only work for a given user id, we can query them directly as a parameter path
@@ -177,10 +283,17 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		AddResource(jsii.String("register"), nil).
 		AddMethod(jsii.String("POST"), usersIntegration, nil)
 
+	// only for administrators
+	// POST /users/employee/register
 	usersResource.AddResource(jsii.String("employee"), nil).
 		AddResource(jsii.String("register"), nil).
 		AddMethod(jsii.String("POST"), usersIntegration, nil)
 
+	// POST /users/administrator/register
+	usersResource.AddResource(jsii.String("administrator"), nil).
+		AddResource(jsii.String("register"), nil).
+		AddMethod(jsii.String("POST"), usersIntegration, nil)
+
 	// GET /users/{id}
 	usersResource.AddResource(jsii.String("{id}"), nil).
 		AddMethod(jsii.String("GET"), usersIntegration, nil)
@@ -199,6 +312,61 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		GetResource(jsii.String("profile")).
 		AddMethod(jsii.String("PUT"), usersIntegration, nil)
 
+	// Enterprise portal, only for enterprise accounts. Always scoped to the enterprise of the token
+	portalResource := api.Root().AddResource(jsii.String("enterprise"), nil)
+
+	// GET /enterprise/coupons
+	portalResource.AddResource(jsii.String("coupons"), nil).
+		AddMethod(jsii.String("GET"), couponsIntegration, nil)
+
+	// GET /enterprise/sales
+	portalResource.AddResource(jsii.String("sales"), nil).
+		AddMethod(jsii.String("GET"), couponsIntegration, nil)
+
+	// GET /enterprise/employees
+	// POST /enterprise/employees
+	portalEmployeesResource := portalResource.AddResource(jsii.String("employees"), nil)
+	portalEmployeesResource.AddMethod(jsii.String("GET"), usersIntegration, nil)
+	portalEmployeesResource.AddMethod(jsii.String("POST"), usersIntegration, nil)
+
+	// DELETE /enterprise/employees/{employeeId}
+	portalEmployeesResource.AddResource(jsii.String("{employeeId}"), nil).
+		AddMethod(jsii.String("DELETE"), usersIntegration, nil)
+
+	// Enterprises resources, only for administrators
+
+	// GET /enterprises
+	// POST /enterprises
+	enterprisesResource := api.Root().AddResource(jsii.String("enterprises"), nil)
+	enterprisesResource.AddMethod(jsii.String("GET"), usersIntegration, nil)
+	enterprisesResource.AddMethod(jsii.String("POST"), usersIntegration, nil)
+
+	// GET /enterprises/{enterpriseId}
+	// PUT /enterprises/{enterpriseId}
+	enterpriseResource := enterprisesResource.AddResource(jsii.String("{enterpriseId}"), nil)
+	enterpriseResource.AddMethod(jsii.String("GET"), usersIntegration, nil)
+	enterpriseResource.AddMethod(jsii.String("PUT"), usersIntegration, nil)
+
+	// POST /enterprises/{enterpriseId}/deactivate
+	enterpriseResource.AddResource(jsii.String("deactivate"), nil).
+		AddMethod(jsii.String("POST"), usersIntegration, nil)
+
+	// user moderation, only for administrators
+	// POST /users/{id}/disable
+	usersResource.GetResource(jsii.String("{id}")).
+		AddResource(jsii.String("disable"), nil).
+		AddMethod(jsii.String("POST"), usersIntegration, nil)
+
+	// POST /users/{id}/enable
+	usersResource.GetResource(jsii.String("{id}")).
+		AddResource(jsii.String("enable"), nil).
+		AddMethod(jsii.String("POST"), usersIntegration, nil)
+
+	// POST /users/{id}/unlock
+	usersResource.GetResource(jsii.String("{id}")).
+		AddResource(jsii.String("unlock"), nil).
+		AddMethod(jsii.String("POST"), usersIntegration, nil)
+
 	// login resources
 	// POST /login/client
 	loginResource := api.Root().AddResource(jsii.String("login"), nil)
@@ -211,6 +379,60 @@ func NewLaCuponeraSamStack(scope constructs.Construct, id string, props *LaCupon
 		AddResource(jsii.String("employee"), nil).
 		AddMethod(jsii.String("POST"), loginIntegration, nil)
 
+	// POST login/enterprise
+	loginResource.
+		AddResource(jsii.String("enterprise"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST login/admin
+	loginResource.
+		AddResource(jsii.String("admin"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// GET /.well-known/jwks.json
+	api.Root().
+		AddResource(jsii.String(".well-known"), nil).
+		AddResource(jsii.String("jwks.json"), nil).
+		AddMethod(jsii.String("GET"), loginIntegration, nil)
+
+	// session resources
+	// POST /auth/refresh
+	authResource := api.Root().AddResource(jsii.String("auth"), nil)
+	authResource.
+		AddResource(jsii.String("refresh"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/logout
+	logoutResource := authResource.AddResource(jsii.String("logout"), nil)
+	logoutResource.AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/logout/all
+	logoutResource.
+		AddResource(jsii.String("all"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/password/forgot
+	passwordResource := authResource.AddResource(jsii.String("password"), nil)
+	passwordResource.
+		AddResource(jsii.String("forgot"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/password/reset
+	passwordResource.
+		AddResource(jsii.String("reset"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/email/verify
+	emailResource := authResource.AddResource(jsii.String("email"), nil)
+	emailResource.
+		AddResource(jsii.String("verify"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
+	// POST /auth/email/resend
+	emailResource.
+		AddResource(jsii.String("resend"), nil).
+		AddMethod(jsii.String("POST"), loginIntegration, nil)
+
 	return stack
 }
 
@@ -3,12 +3,16 @@ package database
 // Add all the methods supported by each of the stores
 
 import (
+	"OriD19/webdev2/pagination"
 	"OriD19/webdev2/types"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -18,9 +22,51 @@ import (
 	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// name of the global secondary indexes defined in the CDK stack
+const (
+	categoryIndex   = "categoryIndex"
+	userOffersIndex = "userOffersIndex"
+	enterpriseIndex = "enterpriseIndex"
+)
+
+// scopes of the pagination cursors, so a cursor can only be used with the list that created it
+const (
+	allCouponsScope  = "coupons"
+	enterprisesScope = "enterprises"
+)
+
+func categoryScope(category string) string {
+	return "coupons/category/" + category
+}
+
+func userOffersScope(userId string) string {
+	return "offers/" + userId
+}
+
+func enterpriseScope(enterpriseId string, entityType string) string {
+	return "enterprises/" + enterpriseId + "/" + entityType
+}
+
+func sessionRevocationId(role string, username string) string {
+	return role + "#" + username
+}
+
+// the token was issued before its user logged out of all the sessions. The iat claim of the access tokens
+// has no fractions of a second, so they're compared without them: a new login right after it is still accepted
+func isRevokedBy(principal types.Principal, revocation types.SessionRevocation) bool {
+	revokedAt := revocation.RevokedAt
+
+	if principal.IssuedAt.Equal(principal.IssuedAt.Truncate(time.Second)) {
+		revokedAt = revokedAt.Truncate(time.Second)
+	}
+
+	return principal.IssuedAt.Before(revokedAt)
+}
+
 type DynamoDBStore struct {
 	client    *dynamodb.Client
 	tableName string
+	cursors   *pagination.Codec
 }
 
 func NewDynamoDBClient(ctx context.Context, tableName string) *DynamoDBStore {
@@ -31,9 +77,15 @@ func NewDynamoDBClient(ctx context.Context, tableName string) *DynamoDBStore {
 
 	client := dynamodb.NewFromConfig(cfg)
 
+	cursors, err := pagination.NewCodecFromEnv()
+	if err != nil {
+		log.Fatalf("unable to create the pagination cursors, %v", err)
+	}
+
 	return &DynamoDBStore{
 		client:    client,
 		tableName: tableName,
+		cursors:   cursors,
 	}
 }
 
@@ -41,7 +93,7 @@ func NewDynamoDBClient(ctx context.Context, tableName string) *DynamoDBStore {
 // COUPON METHODS
 // ************************************************************
 
-func (d *DynamoDBStore) GetAllCoupons(ctx context.Context, nextToken *string) (types.CouponRange, error) {
+func (d *DynamoDBStore) GetAllCoupons(ctx context.Context, nextToken *string, limit int32) (types.CouponRange, error) {
 
 	couponRange := types.CouponRange{
 		Coupons: []types.Coupon{},
@@ -49,8 +101,10 @@ func (d *DynamoDBStore) GetAllCoupons(ctx context.Context, nextToken *string) (t
 
 	input := &dynamodb.QueryInput{
 		TableName:              &d.tableName,
-		Limit:                  aws.Int32(10), // for pagination purposes
+		Limit:                  aws.Int32(limit), // for pagination purposes
 		KeyConditionExpression: aws.String("entityType = :entityType"),
+		// the clients only see the approved coupons that are still valid
+		FilterExpression: aws.String(publicCouponsFilter),
 		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
 			":entityType": &ddbtypes.AttributeValueMemberS{
 				Value: "coupon",
@@ -58,15 +112,18 @@ func (d *DynamoDBStore) GetAllCoupons(ctx context.Context, nextToken *string) (t
 		},
 	}
 
+	if err := addPublicCouponsValues(input.ExpressionAttributeValues); err != nil {
+		return couponRange, err
+	}
+
 	if nextToken != nil {
-		input.ExclusiveStartKey = map[string]ddbtypes.AttributeValue{
-			"entityType": &ddbtypes.AttributeValueMemberS{
-				Value: "coupon",
-			},
-			"id": &ddbtypes.AttributeValueMemberS{
-				Value: *nextToken,
-			},
+		startKey, err := d.cursors.Decode(allCouponsScope, *nextToken)
+
+		if err != nil {
+			return couponRange, err
 		}
+
+		input.ExclusiveStartKey = startKey
 	}
 
 	result, err := d.client.Query(ctx, input)
@@ -83,27 +140,27 @@ func (d *DynamoDBStore) GetAllCoupons(ctx context.Context, nextToken *string) (t
 		return couponRange, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
 	}
 
-	if len(result.LastEvaluatedKey) > 0 {
-		if key, ok := result.LastEvaluatedKey["id"]; ok {
-			nextKey := key.(*ddbtypes.AttributeValueMemberS).Value
-			couponRange.Next = &nextKey
-		}
+	couponRange.Next, err = d.cursors.Encode(allCouponsScope, result.LastEvaluatedKey)
+
+	if err != nil {
+		return couponRange, err
 	}
 
 	return couponRange, nil
 }
 
-func (d *DynamoDBStore) GetAllCouponsFromCategory(ctx context.Context, category string) (types.CouponRange, error) {
+func (d *DynamoDBStore) GetAllCouponsFromCategory(ctx context.Context, category string, nextToken *string, limit int32) (types.CouponRange, error) {
 	couponRange := types.CouponRange{
 		Coupons: []types.Coupon{},
 	}
 
-	// DONE: Check this thing, because Copilot is terrible
+	// the category index only contains the coupons of the category, so only the state is filtered
 	input := &dynamodb.QueryInput{
 		TableName:              &d.tableName,
-		KeyConditionExpression: aws.String("entityType = :entityType"),
-		// More read operations, maybe an index would be useful...
-		FilterExpression: aws.String("#category = :category"), // filter only by category
+		IndexName:              aws.String(categoryIndex),
+		Limit:                  aws.Int32(limit),
+		KeyConditionExpression: aws.String("#category = :category AND entityType = :entityType"),
+		FilterExpression:       aws.String(publicCouponsFilter),
 		ExpressionAttributeNames: map[string]string{
 			"#category": "category",
 		},
@@ -117,6 +174,21 @@ func (d *DynamoDBStore) GetAllCouponsFromCategory(ctx context.Context, category
 		},
 	}
 
+	if err := addPublicCouponsValues(input.ExpressionAttributeValues); err != nil {
+		return couponRange, err
+	}
+
+	if nextToken != nil {
+		// the cursor carries the keys of the index too
+		startKey, err := d.cursors.Decode(categoryScope(category), *nextToken)
+
+		if err != nil {
+			return couponRange, err
+		}
+
+		input.ExclusiveStartKey = startKey
+	}
+
 	result, err := d.client.Query(ctx, input)
 
 	if err != nil {
@@ -131,9 +203,34 @@ func (d *DynamoDBStore) GetAllCouponsFromCategory(ctx context.Context, category
 		return couponRange, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
 	}
 
+	couponRange.Next, err = d.cursors.Encode(categoryScope(category), result.LastEvaluatedKey)
+
+	if err != nil {
+		return couponRange, err
+	}
+
 	return couponRange, nil
 }
 
+// filter for the coupons that can be shown to the clients.
+// The pages can have less items than the limit, because the filter is applied after reading them
+const publicCouponsFilter = "couponState = :active AND validFrom <= :now AND validUntil > :now"
+
+func addPublicCouponsValues(values map[string]ddbtypes.AttributeValue) error {
+	now, err := attributevalue.Marshal(time.Now().UTC())
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal current date, %v", err)
+	}
+
+	values[":active"] = &ddbtypes.AttributeValueMemberS{
+		Value: types.CouponStateActive,
+	}
+	values[":now"] = now
+
+	return nil
+}
+
 func (d *DynamoDBStore) GetCoupon(c context.Context, id string) (types.Coupon, error) {
 	// query a single coupon with the GetItem API. Better resource (RCU) efficiency
 	input := &dynamodb.GetItemInput{
@@ -154,6 +251,10 @@ func (d *DynamoDBStore) GetCoupon(c context.Context, id string) (types.Coupon, e
 		return types.Coupon{}, err
 	}
 
+	if len(result.Item) == 0 {
+		return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+	}
+
 	var coupon types.Coupon
 	err = attributevalue.UnmarshalMap(result.Item, &coupon)
 
@@ -186,45 +287,176 @@ func (d *DynamoDBStore) PutCoupon(c context.Context, coupon types.Coupon) error
 	return nil
 }
 
-func (d *DynamoDBStore) PutGeneratedOffer(c context.Context, offer types.GeneratedOffer) error {
-	offer.EntityType = "generatedOffer"
-	av, err := attributevalue.MarshalMap(offer)
+// move the coupon to a new state and append the transition to its history.
+// The update only happens if nobody changed the state since it was read
+func (d *DynamoDBStore) UpdateCouponState(c context.Context, id string, transition types.CouponTransition) (types.Coupon, error) {
+	history, err := attributevalue.Marshal([]types.CouponTransition{transition})
 
 	if err != nil {
-		return fmt.Errorf("failed to marshal generated offer, %v", err)
+		return types.Coupon{}, fmt.Errorf("failed to marshal state transition, %v", err)
 	}
 
-	input := &dynamodb.PutItemInput{
+	input := &dynamodb.UpdateItemInput{
 		TableName: &d.tableName,
-		Item:      av,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "coupon",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: id,
+			},
+		},
+		UpdateExpression:    aws.String("SET couponState = :to, stateHistory = list_append(if_not_exists(stateHistory, :empty), :transition)"),
+		ConditionExpression: aws.String("attribute_exists(id) AND couponState = :from"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":from": &ddbtypes.AttributeValueMemberS{
+				Value: transition.From,
+			},
+			":to": &ddbtypes.AttributeValueMemberS{
+				Value: transition.To,
+			},
+			":transition": history,
+			":empty": &ddbtypes.AttributeValueMemberL{
+				Value: []ddbtypes.AttributeValue{},
+			},
+		},
+		ReturnValues:                        ddbtypes.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
 	}
 
-	_, err = d.client.PutItem(c, input)
+	result, err := d.client.UpdateItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		if len(conditionFailed.Item) == 0 {
+			return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+		}
+
+		// the state was changed by someone else
+		return types.Coupon{}, fmt.Errorf("coupon is no longer %s: %w", transition.From, types.ErrInvalidState)
+	}
+
+	if err != nil {
+		return types.Coupon{}, fmt.Errorf("failed to update coupon state, %v", err)
+	}
+
+	var coupon types.Coupon
+	err = attributevalue.UnmarshalMap(result.Attributes, &coupon)
 
 	if err != nil {
-		return fmt.Errorf("failed to put generated offer, %v", err)
+		return types.Coupon{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return coupon, nil
+}
+
+func (d *DynamoDBStore) UpdateCoupon(c context.Context, id string, update types.CouponUpdate) (types.Coupon, error) {
+	values := map[string]ddbtypes.AttributeValue{
+		":pending":  &ddbtypes.AttributeValueMemberS{Value: types.CouponStatePending},
+		":active":   &ddbtypes.AttributeValueMemberS{Value: types.CouponStateActive},
+		":inactive": &ddbtypes.AttributeValueMemberS{Value: types.CouponStateInactive},
 	}
 
-	// we need to decrease the count of available coupons
+	// only the fields of the update are set, so the counters are never written
+	var set []string
+
+	addField := func(attribute string, value interface{}) error {
+		av, err := attributevalue.Marshal(value)
+
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s, %v", attribute, err)
+		}
+
+		set = append(set, attribute+" = :"+attribute)
+		values[":"+attribute] = av
+
+		return nil
+	}
 
-	// get the coupon associated with the generated offer
-	coupon, err := d.GetCoupon(c, offer.CouponId)
+	now, err := attributevalue.Marshal(time.Now().UTC())
 
 	if err != nil {
-		return fmt.Errorf("failed to get coupon, %v", err)
+		return types.Coupon{}, fmt.Errorf("failed to marshal current date, %v", err)
+	}
+
+	values[":now"] = now
+
+	if update.Title != nil {
+		err = errors.Join(err, addField("title", *update.Title))
+	}
+
+	if update.RegularPrice != nil {
+		err = errors.Join(err, addField("regularPrice", *update.RegularPrice))
+	}
+
+	if update.OfferPrice != nil {
+		err = errors.Join(err, addField("offerPrice", *update.OfferPrice))
+	}
+
+	if update.ValidUntil != nil {
+		// dates are compared as strings, so all of them are saved in UTC
+		err = errors.Join(err, addField("validUntil", update.ValidUntil.UTC()))
 	}
 
-	// decrease the count of available coupons
-	coupon.AvailableCoupons--
+	if update.OfferDesc != nil {
+		err = errors.Join(err, addField("offerDesc", *update.OfferDesc))
+	}
 
-	// update the coupon in the database
-	err = d.PutCoupon(c, coupon)
+	if update.MaxPerClient != nil {
+		err = errors.Join(err, addField("maxPerClient", *update.MaxPerClient))
+	}
 
 	if err != nil {
-		return fmt.Errorf("failed to update coupon availability, %v", err)
+		return types.Coupon{}, err
 	}
 
-	return nil
+	if len(set) == 0 {
+		return d.GetCoupon(c, id)
+	}
+
+	// a coupon past its date is expired, even if no one read it since then
+	input := &dynamodb.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "coupon",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: id,
+			},
+		},
+		UpdateExpression:                    aws.String("SET " + strings.Join(set, ", ")),
+		ConditionExpression:                 aws.String("attribute_exists(id) AND couponState IN (:pending, :active, :inactive) AND validUntil > :now"),
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        ddbtypes.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	result, err := d.client.UpdateItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		if len(conditionFailed.Item) == 0 {
+			return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+		}
+
+		return types.Coupon{}, fmt.Errorf("expired or rejected coupons can't be edited: %w", types.ErrInvalidState)
+	}
+
+	if err != nil {
+		return types.Coupon{}, fmt.Errorf("failed to update coupon, %v", err)
+	}
+
+	var coupon types.Coupon
+	err = attributevalue.UnmarshalMap(result.Attributes, &coupon)
+
+	if err != nil {
+		return types.Coupon{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return coupon, nil
 }
 
 func (d *DynamoDBStore) GenerateId(c context.Context, enterpriseId string) (string, error) {
@@ -241,7 +473,7 @@ func (d *DynamoDBStore) GenerateId(c context.Context, enterpriseId string) (stri
 	enterprise, err := d.GetEnterprise(c, enterpriseId)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to get enterprise, %v", err)
+		return "", fmt.Errorf("failed to get enterprise: %w", err)
 	}
 
 	return fmt.Sprintf("%s%d", enterprise.EnterpriseCode, randInt), nil
@@ -251,22 +483,28 @@ func (d *DynamoDBStore) GenerateId(c context.Context, enterpriseId string) (stri
 // only clients can buy a coupon
 func (d *DynamoDBStore) BuyCoupon(c context.Context, couponId string, userId string) (types.GeneratedOffer, error) {
 
+	// this read is only used for copying the coupon details into the offer.
+	// The availability is checked again (atomically) inside the transaction
 	coupon, err := d.GetCoupon(c, couponId)
 
 	if err != nil {
-		return types.GeneratedOffer{}, fmt.Errorf("failed to get coupon, %v", err)
+		return types.GeneratedOffer{}, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	// fail fast, without starting a transaction
+	if !coupon.IsOnSale(time.Now()) {
+		return types.GeneratedOffer{}, fmt.Errorf("coupon is not available for purchase: %w", types.ErrInvalidState)
 	}
 
-	// check if the coupon is still available
-	if coupon.AvailableCoupons <= 0 {
-		return types.GeneratedOffer{}, fmt.Errorf("coupon is not available")
+	if !coupon.IsUnlimited() && coupon.AvailableCoupons <= 0 {
+		return types.GeneratedOffer{}, types.ErrSoldOut
 	}
 
 	// get the user associated with the coupon
 	user, err := d.GetClient(c, userId)
 
 	if err != nil {
-		return types.GeneratedOffer{}, fmt.Errorf("failed to get user, %v", err)
+		return types.GeneratedOffer{}, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	var newGenOffer types.GeneratedOffer
@@ -275,52 +513,248 @@ func (d *DynamoDBStore) BuyCoupon(c context.Context, couponId string, userId str
 	generatedId, err := d.GenerateId(c, coupon.EnterpriseId)
 
 	if err != nil {
-		return types.GeneratedOffer{}, fmt.Errorf("failed to generate ID, %v", err)
+		return types.GeneratedOffer{}, fmt.Errorf("failed to generate ID: %w", err)
 	}
 
 	newGenOffer.EntityType = "generatedOffer"
 	newGenOffer.Id = generatedId
 	newGenOffer.UserId = user.Username // username as the ID of the user
 	newGenOffer.CouponId = coupon.Id
+	newGenOffer.EnterpriseId = coupon.EnterpriseId
 	newGenOffer.GeneratedAt = time.Now()
 	newGenOffer.ExpirationDate = coupon.ValidUntil
 	newGenOffer.Redeemed = false
 	newGenOffer.RegularPrice = coupon.RegularPrice
 	newGenOffer.OfferPrice = coupon.OfferPrice
 
-	// save the generated offer in the database
-	err = d.PutGeneratedOffer(c, newGenOffer)
+	av, err := attributevalue.MarshalMap(newGenOffer)
 
 	if err != nil {
-		return types.GeneratedOffer{}, fmt.Errorf("failed to put generated offer, %v", err)
+		return types.GeneratedOffer{}, fmt.Errorf("failed to marshal generated offer, %v", err)
+	}
+
+	now, err := attributevalue.Marshal(time.Now().UTC())
+
+	if err != nil {
+		return types.GeneratedOffer{}, fmt.Errorf("failed to marshal current date, %v", err)
+	}
+
+	input := purchaseTransaction(d.tableName, coupon, user.Username, av, now)
+
+	_, err = d.client.TransactWriteItems(c, input)
+
+	if err != nil {
+		return types.GeneratedOffer{}, purchaseError(err)
 	}
 
 	return newGenOffer, nil
 }
 
+// the writes of a purchase: the coupon inventory, the generated offer and the purchases counter of the client
+func purchaseTransaction(tableName string, coupon types.Coupon, userId string, offer map[string]ddbtypes.AttributeValue, now ddbtypes.AttributeValue) *dynamodb.TransactWriteItemsInput {
+	// the unlimited coupons have no inventory, only the sold count is increased.
+	// The condition checks that the coupon is still unlimited when the transaction runs.
+	// Unused values are not allowed inside the expression, so each mode only sends its own
+	updateExpression := "SET availableCoupons = availableCoupons - :one ADD soldCoupons :one"
+	stockCondition := "availableCoupons > :zero"
+	stockName, stockValue := ":zero", "0"
+
+	if coupon.IsUnlimited() {
+		updateExpression = "ADD soldCoupons :one"
+		stockCondition = "availableCoupons = :unlimited"
+		stockName, stockValue = ":unlimited", strconv.Itoa(types.UnlimitedCoupons)
+	}
+
+	// the purchases of each client are counted even without a limit, so a limit added later
+	// also counts the coupons bought before it
+	purchasesCondition := "attribute_not_exists(purchases) OR purchases < :max"
+
+	if coupon.MaxPerClient <= 0 {
+		purchasesCondition = ""
+	}
+
+	// decrement the inventory, save the offer and count the purchase as a single unit.
+	// Either all the writes succeed, or none of them is applied
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []ddbtypes.TransactWriteItem{
+			{
+				Update: &ddbtypes.Update{
+					TableName: &tableName,
+					Key: map[string]ddbtypes.AttributeValue{
+						"entityType": &ddbtypes.AttributeValueMemberS{
+							Value: "coupon",
+						},
+						"id": &ddbtypes.AttributeValueMemberS{
+							Value: coupon.Id,
+						},
+					},
+					UpdateExpression:    aws.String(updateExpression),
+					ConditionExpression: aws.String("attribute_exists(id) AND " + stockCondition + " AND couponState = :active AND validFrom <= :now AND validUntil > :now"),
+					ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+						":active": &ddbtypes.AttributeValueMemberS{
+							Value: types.CouponStateActive,
+						},
+						":now": now,
+						":one": &ddbtypes.AttributeValueMemberN{
+							Value: "1",
+						},
+					},
+					// used to know which one of the checks failed
+					ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Put: &ddbtypes.Put{
+					TableName: &tableName,
+					Item:      offer,
+					// never overwrite an offer that was already bought
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Update: &ddbtypes.Update{
+					TableName: &tableName,
+					Key: map[string]ddbtypes.AttributeValue{
+						"entityType": &ddbtypes.AttributeValueMemberS{
+							Value: "couponPurchases",
+						},
+						"id": &ddbtypes.AttributeValueMemberS{
+							Value: couponPurchasesId(coupon.Id, userId),
+						},
+					},
+					UpdateExpression: aws.String("ADD purchases :one"),
+					ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+						":one": &ddbtypes.AttributeValueMemberN{
+							Value: "1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	input.TransactItems[0].Update.ExpressionAttributeValues[stockName] = &ddbtypes.AttributeValueMemberN{
+		Value: stockValue,
+	}
+
+	if purchasesCondition != "" {
+		counter := input.TransactItems[2].Update
+		counter.ConditionExpression = aws.String(purchasesCondition)
+		counter.ExpressionAttributeValues[":max"] = &ddbtypes.AttributeValueMemberN{
+			Value: strconv.Itoa(coupon.MaxPerClient),
+		}
+	}
+
+	return input
+}
+
+// one counter for each client and coupon
+func couponPurchasesId(couponId string, userId string) string {
+	return couponId + "#" + userId
+}
+
+// translate a failed purchase transaction into one of the store errors
+func purchaseError(err error) error {
+	var canceled *ddbtypes.TransactionCanceledException
+
+	if !errors.As(err, &canceled) {
+		return fmt.Errorf("failed to buy coupon, %v", err)
+	}
+
+	// the reasons are returned in the same order as the transaction items:
+	// [0] is the coupon update, [1] is the generated offer put, [2] is the purchases counter of the client
+	reasons := canceled.CancellationReasons
+
+	if len(reasons) > 0 && aws.ToString(reasons[0].Code) == "ConditionalCheckFailed" {
+		var coupon types.Coupon
+
+		// the coupon was sold out, unless it was deactivated or expired in the meantime
+		if err := attributevalue.UnmarshalMap(reasons[0].Item, &coupon); err == nil && len(reasons[0].Item) > 0 {
+			if !coupon.IsOnSale(time.Now()) {
+				return fmt.Errorf("coupon is not available for purchase: %w", types.ErrInvalidState)
+			}
+
+			// the stock mode changed between the read and the transaction, the purchase can be retried
+			if coupon.AvailableCoupons != 0 {
+				return fmt.Errorf("failed to buy coupon: %w", types.ErrConflict)
+			}
+		}
+
+		return types.ErrSoldOut
+	}
+
+	if len(reasons) > 2 && aws.ToString(reasons[2].Code) == "ConditionalCheckFailed" {
+		return types.ErrPurchaseLimit
+	}
+
+	for _, reason := range reasons {
+		switch aws.ToString(reason.Code) {
+		// another transaction was touching the same coupon, or the offer ID already exists
+		case "TransactionConflict", "ConditionalCheckFailed":
+			return fmt.Errorf("failed to buy coupon: %w", types.ErrConflict)
+		}
+	}
+
+	return fmt.Errorf("failed to buy coupon, %v", err)
+}
+
 // get the user ID from a route parameter
-func (d *DynamoDBStore) GetUserOffers(c context.Context, userId string) (types.OfferRange, error) {
-	// query all the generated offers for a given user
+func (d *DynamoDBStore) GetUserOffers(c context.Context, userId string, query types.OfferQuery) (types.OfferRange, error) {
+	// query the generated offers for a given user, through the index sorted by purchase date
 	offers := types.OfferRange{
 		Offers: []types.GeneratedOffer{},
 	}
+
 	input := &dynamodb.QueryInput{
 		TableName:              &d.tableName,
-		KeyConditionExpression: aws.String("entityType = :entityType"),
-		FilterExpression:       aws.String("#userId = :userId"),
-		ExpressionAttributeNames: map[string]string{
-			"#userId": "userId",
-		},
+		IndexName:              aws.String(userOffersIndex),
+		Limit:                  aws.Int32(query.Limit),
+		ScanIndexForward:       aws.Bool(query.Ascending),
+		KeyConditionExpression: aws.String("userId = :userId"),
 		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
-			":entityType": &ddbtypes.AttributeValueMemberS{
-				Value: "generatedOffer",
-			},
 			":userId": &ddbtypes.AttributeValueMemberS{
 				Value: userId,
 			},
 		},
 	}
 
+	if query.Status != "" {
+		now, err := attributevalue.Marshal(time.Now().UTC())
+
+		if err != nil {
+			return offers, fmt.Errorf("failed to marshal current date, %v", err)
+		}
+
+		switch query.Status {
+		case types.OfferStatusActive:
+			input.FilterExpression = aws.String("redeemed = :false AND validUntil > :now")
+		case types.OfferStatusExpired:
+			input.FilterExpression = aws.String("redeemed = :false AND validUntil <= :now")
+		case types.OfferStatusRedeemed:
+			input.FilterExpression = aws.String("redeemed = :true")
+		default:
+			return offers, fmt.Errorf("unknown offer status %s", query.Status)
+		}
+
+		// unused values are not allowed inside the expression
+		if query.Status == types.OfferStatusRedeemed {
+			input.ExpressionAttributeValues[":true"] = &ddbtypes.AttributeValueMemberBOOL{Value: true}
+		} else {
+			input.ExpressionAttributeValues[":false"] = &ddbtypes.AttributeValueMemberBOOL{Value: false}
+			input.ExpressionAttributeValues[":now"] = now
+		}
+	}
+
+	if query.Next != nil {
+		startKey, err := d.cursors.Decode(userOffersScope(userId), *query.Next)
+
+		if err != nil {
+			return offers, err
+		}
+
+		input.ExclusiveStartKey = startKey
+	}
+
 	result, err := d.client.Query(c, input)
 
 	if err != nil {
@@ -333,6 +767,12 @@ func (d *DynamoDBStore) GetUserOffers(c context.Context, userId string) (types.O
 		return offers, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
 	}
 
+	offers.Next, err = d.cursors.Encode(userOffersScope(userId), result.LastEvaluatedKey)
+
+	if err != nil {
+		return offers, err
+	}
+
 	return offers, nil
 }
 
@@ -356,6 +796,10 @@ func (d *DynamoDBStore) GetGeneratedOffer(c context.Context, id string) (types.G
 		return types.GeneratedOffer{}, err
 	}
 
+	if len(result.Item) == 0 {
+		return types.GeneratedOffer{}, fmt.Errorf("offer %w", types.ErrNotFound)
+	}
+
 	var offer types.GeneratedOffer
 	err = attributevalue.UnmarshalMap(result.Item, &offer)
 
@@ -366,59 +810,175 @@ func (d *DynamoDBStore) GetGeneratedOffer(c context.Context, id string) (types.G
 	return offer, nil
 }
 
-func (d *DynamoDBStore) RedeemCoupon(c context.Context, id string) error {
-	// get the generated offer
-	offer, err := d.GetGeneratedOffer(c, id)
+func (d *DynamoDBStore) GetEnterpriseCoupons(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.CouponRange, error) {
+	couponRange := types.CouponRange{
+		Coupons: []types.Coupon{},
+	}
+
+	next, err := d.queryEnterpriseIndex(c, enterpriseId, "coupon", nextToken, limit, &couponRange.Coupons)
 
 	if err != nil {
-		return fmt.Errorf("failed to get generated offer, %v", err)
+		return couponRange, err
 	}
 
-	// check if the offer is still valid
-	if offer.ExpirationDate.Before(time.Now()) {
-		return fmt.Errorf("offer is expired")
-	}
+	couponRange.Next = next
 
-	// check if the offer is already redeemed
-	if offer.Redeemed {
-		return fmt.Errorf("offer is already redeemed")
-	}
+	return couponRange, nil
+}
 
-	// mark the offer as redeemed
-	offer.Redeemed = true
+func (d *DynamoDBStore) GetEnterpriseOffers(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.OfferRange, error) {
+	offers := types.OfferRange{
+		Offers: []types.GeneratedOffer{},
+	}
 
-	// update the offer in the database
-	err = d.PutGeneratedOffer(c, offer)
+	next, err := d.queryEnterpriseIndex(c, enterpriseId, "generatedOffer", nextToken, limit, &offers.Offers)
 
 	if err != nil {
-		return fmt.Errorf("failed to update generated offer, %v", err)
+		return offers, err
 	}
 
-	return nil
-}
+	offers.Next = next
 
-// ************************************************************
-// USER METHODS
-// ************************************************************
+	return offers, nil
+}
 
-// !IMPORTANT: REGISTER METHODS ALSO UPDATES IF THE VALUE ALREADY EXISTS
-func (d *DynamoDBStore) RegisterClient(c context.Context, client types.Client) error {
-	client.EntityType = "client"
-	av, err := attributevalue.MarshalMap(client)
+// query a single page of the items of an enterprise (coupons, offers or employees) and unmarshal them into out.
+// Returns the cursor for the next page
+func (d *DynamoDBStore) queryEnterpriseIndex(c context.Context, enterpriseId string, entityType string, nextToken *string, limit int32, out interface{}) (*string, error) {
+	scope := enterpriseScope(enterpriseId, entityType)
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal client, %v", err)
+	input := &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		IndexName:              aws.String(enterpriseIndex),
+		Limit:                  aws.Int32(limit),
+		KeyConditionExpression: aws.String("enterpriseCode = :enterpriseId AND entityType = :entityType"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":enterpriseId": &ddbtypes.AttributeValueMemberS{
+				Value: enterpriseId,
+			},
+			":entityType": &ddbtypes.AttributeValueMemberS{
+				Value: entityType,
+			},
+		},
 	}
 
-	input := &dynamodb.PutItemInput{
-		TableName: &d.tableName,
-		Item:      av,
-	}
+	if nextToken != nil {
+		startKey, err := d.cursors.Decode(scope, *nextToken)
 
-	_, err = d.client.PutItem(c, input)
+		if err != nil {
+			return nil, err
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to put client, %v", err)
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := d.client.Query(c, input)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the items of the enterprise, %v", err)
+	}
+
+	err = attributevalue.UnmarshalListOfMaps(result.Items, out)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return d.cursors.Encode(scope, result.LastEvaluatedKey)
+}
+
+// mark the offer as redeemed by the given employee, only if it was not redeemed yet and it is still valid.
+// The check and the update are a single conditional write, so an offer can't be redeemed twice
+func (d *DynamoDBStore) RedeemCoupon(c context.Context, id string, employee types.Employee) error {
+	now, err := attributevalue.Marshal(time.Now().UTC())
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal redemption date, %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "generatedOffer",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: id,
+			},
+		},
+		UpdateExpression:    aws.String("SET redeemed = :true, redeemedAt = :now, redeemedBy = :employee, redeemedAtEnterprise = :enterprise"),
+		ConditionExpression: aws.String("attribute_exists(id) AND redeemed = :false AND validUntil > :now"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":true": &ddbtypes.AttributeValueMemberBOOL{
+				Value: true,
+			},
+			":false": &ddbtypes.AttributeValueMemberBOOL{
+				Value: false,
+			},
+			":now": now,
+			":employee": &ddbtypes.AttributeValueMemberS{
+				Value: employee.Username,
+			},
+			":enterprise": &ddbtypes.AttributeValueMemberS{
+				Value: employee.EnterpriseId,
+			},
+		},
+		// return the current item when the condition fails, to know which one of the checks failed
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	_, err = d.client.UpdateItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		if len(conditionFailed.Item) == 0 {
+			return fmt.Errorf("offer %w", types.ErrNotFound)
+		}
+
+		var offer types.GeneratedOffer
+		err = attributevalue.UnmarshalMap(conditionFailed.Item, &offer)
+
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+		}
+
+		if offer.Redeemed {
+			return types.ErrAlreadyRedeemed
+		}
+
+		return types.ErrExpired
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update generated offer, %v", err)
+	}
+
+	return nil
+}
+
+// ************************************************************
+// USER METHODS
+// ************************************************************
+
+// !IMPORTANT: REGISTER METHODS ALSO UPDATES IF THE VALUE ALREADY EXISTS
+func (d *DynamoDBStore) RegisterClient(c context.Context, client types.Client) error {
+	client.EntityType = "client"
+	av, err := attributevalue.MarshalMap(client)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal client, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put client, %v", err)
 	}
 
 	return nil
@@ -512,7 +1072,7 @@ func (d *DynamoDBStore) GetClient(c context.Context, username string) (types.Cli
 	}
 
 	if len(result.Item) == 0 {
-		return types.Client{}, fmt.Errorf("client not found")
+		return types.Client{}, fmt.Errorf("client %w", types.ErrNotFound)
 	}
 
 	var client types.Client
@@ -545,6 +1105,10 @@ func (d *DynamoDBStore) GetEnterprise(c context.Context, id string) (types.Enter
 		return types.Enterprise{}, err
 	}
 
+	if len(result.Item) == 0 {
+		return types.Enterprise{}, fmt.Errorf("enterprise %w", types.ErrNotFound)
+	}
+
 	var enterprise types.Enterprise
 	err = attributevalue.UnmarshalMap(result.Item, &enterprise)
 
@@ -555,6 +1119,88 @@ func (d *DynamoDBStore) GetEnterprise(c context.Context, id string) (types.Enter
 	return enterprise, nil
 }
 
+// the codes are saved as their own items, so the uniqueness can be checked with a conditional write
+func (d *DynamoDBStore) ReserveEnterpriseCode(c context.Context, code string, enterpriseId string) error {
+	reservation := types.EnterpriseCodeReservation{
+		Code:         code,
+		EnterpriseId: enterpriseId,
+	}
+	reservation.EntityType = "enterpriseCode"
+
+	av, err := attributevalue.MarshalMap(reservation)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal enterprise code, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           &d.tableName,
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		return fmt.Errorf("enterprise code %s is already in use: %w", code, types.ErrConflict)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to put enterprise code, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) ListEnterprises(c context.Context, nextToken *string, limit int32) (types.EnterpriseRange, error) {
+	enterpriseRange := types.EnterpriseRange{
+		Enterprises: []types.Enterprise{},
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		Limit:                  aws.Int32(limit),
+		KeyConditionExpression: aws.String("entityType = :entityType"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "enterprise",
+			},
+		},
+	}
+
+	if nextToken != nil {
+		startKey, err := d.cursors.Decode(enterprisesScope, *nextToken)
+
+		if err != nil {
+			return enterpriseRange, err
+		}
+
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := d.client.Query(c, input)
+
+	if err != nil {
+		return enterpriseRange, fmt.Errorf("failed to query enterprises, %v", err)
+	}
+
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &enterpriseRange.Enterprises)
+
+	if err != nil {
+		return enterpriseRange, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	enterpriseRange.Next, err = d.cursors.Encode(enterprisesScope, result.LastEvaluatedKey)
+
+	if err != nil {
+		return enterpriseRange, err
+	}
+
+	return enterpriseRange, nil
+}
+
 func (d *DynamoDBStore) GetAdministrator(c context.Context, id string) (types.Administrator, error) {
 	// query a single administrator with the GetItem API. Better resource (RCU) efficiency
 	input := &dynamodb.GetItemInput{
@@ -575,6 +1221,10 @@ func (d *DynamoDBStore) GetAdministrator(c context.Context, id string) (types.Ad
 		return types.Administrator{}, err
 	}
 
+	if len(result.Item) == 0 {
+		return types.Administrator{}, fmt.Errorf("administrator %w", types.ErrNotFound)
+	}
+
 	var administrator types.Administrator
 	err = attributevalue.UnmarshalMap(result.Item, &administrator)
 
@@ -606,7 +1256,7 @@ func (d *DynamoDBStore) GetEmployee(c context.Context, id string) (types.Employe
 	}
 
 	if len(result.Item) == 0 {
-		return types.Employee{}, fmt.Errorf("employee not found")
+		return types.Employee{}, fmt.Errorf("employee %w", types.ErrNotFound)
 	}
 
 	var employee types.Employee
@@ -618,3 +1268,743 @@ func (d *DynamoDBStore) GetEmployee(c context.Context, id string) (types.Employe
 
 	return employee, nil
 }
+
+func (d *DynamoDBStore) UpdateClient(c context.Context, username string, update types.UserUpdate) (types.Client, error) {
+	var client types.Client
+
+	item, err := d.updateUser(c, "client", username, update)
+
+	if err != nil || item == nil {
+		return client, err
+	}
+
+	err = attributevalue.UnmarshalMap(item, &client)
+
+	if err != nil {
+		return types.Client{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return client, nil
+}
+
+func (d *DynamoDBStore) UpdateEmployee(c context.Context, username string, update types.UserUpdate) (types.Employee, error) {
+	var employee types.Employee
+
+	item, err := d.updateUser(c, "employee", username, update)
+
+	if err != nil || item == nil {
+		return employee, err
+	}
+
+	err = attributevalue.UnmarshalMap(item, &employee)
+
+	if err != nil {
+		return types.Employee{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return employee, nil
+}
+
+// set only the fields of the update, and return the whole user as it was saved
+func (d *DynamoDBStore) updateUser(c context.Context, entityType string, username string, update types.UserUpdate) (map[string]ddbtypes.AttributeValue, error) {
+	input, err := userUpdateInput(d.tableName, entityType, username, update)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := d.client.UpdateItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		if len(conditionFailed.Item) == 0 {
+			return nil, fmt.Errorf("%s %w", entityType, types.ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("the email of the %s changed: %w", entityType, types.ErrConflict)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s, %v", entityType, err)
+	}
+
+	return result.Attributes, nil
+}
+
+// the attributes that are not in the update are left as they are
+func userUpdateInput(tableName string, entityType string, username string, update types.UserUpdate) (*dynamodb.UpdateItemInput, error) {
+	values := map[string]ddbtypes.AttributeValue{}
+	var set []string
+
+	addField := func(attribute string, value *string) {
+		if value != nil {
+			set = append(set, attribute+" = :"+attribute)
+			values[":"+attribute] = &ddbtypes.AttributeValueMemberS{Value: *value}
+		}
+	}
+
+	addField("password", update.Password)
+	addField("disabledReason", update.DisabledReason)
+	addField("firstName", update.FirstName)
+	addField("lastName", update.LastName)
+	addField("address", update.Address)
+	addField("phoneNumber", update.PhoneNumber)
+	addField("email", update.Email)
+	addField("emailState", update.EmailState)
+
+	if update.Disabled != nil {
+		set = append(set, "disabled = :disabled")
+		values[":disabled"] = &ddbtypes.AttributeValueMemberBOOL{Value: *update.Disabled}
+	}
+
+	if len(set) == 0 {
+		return nil, fmt.Errorf("%w: nothing to update", types.ErrValidation)
+	}
+
+	condition := "attribute_exists(id)"
+
+	if update.IfEmail != nil {
+		condition += " AND email = :ifEmail"
+		values[":ifEmail"] = &ddbtypes.AttributeValueMemberS{Value: *update.IfEmail}
+	}
+
+	return &dynamodb.UpdateItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: entityType,
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: username,
+			},
+		},
+		UpdateExpression:                    aws.String("SET " + strings.Join(set, ", ")),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        ddbtypes.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	}, nil
+}
+
+func (d *DynamoDBStore) GetEnterpriseEmployees(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.EmployeeRange, error) {
+	employees := types.EmployeeRange{
+		Employees: []types.Employee{},
+	}
+
+	next, err := d.queryEnterpriseIndex(c, enterpriseId, "employee", nextToken, limit, &employees.Employees)
+
+	if err != nil {
+		return employees, err
+	}
+
+	employees.Next = next
+
+	return employees, nil
+}
+
+func (d *DynamoDBStore) DeleteEmployee(c context.Context, id string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "employee",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: id,
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	}
+
+	_, err := d.client.DeleteItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		return fmt.Errorf("employee %w", types.ErrNotFound)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete employee, %v", err)
+	}
+
+	return nil
+}
+
+// ************************************************************
+// IDEMPOTENCY METHODS
+// ************************************************************
+
+func (d *DynamoDBStore) ReserveIdempotencyKey(c context.Context, record types.IdempotencyRecord) error {
+	record.EntityType = "idempotencyKey"
+	av, err := attributevalue.MarshalMap(record)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+		// the TTL deletion is not immediate, so an expired record can also be replaced
+		ConditionExpression: aws.String("attribute_not_exists(id) OR #ttl < :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": "ttl",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":now": &ddbtypes.AttributeValueMemberN{
+				Value: strconv.FormatInt(time.Now().Unix(), 10),
+			},
+		},
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+
+	if errors.As(err, &conditionFailed) {
+		return fmt.Errorf("idempotency key already in use: %w", types.ErrConflict)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to put idempotency record, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) GetIdempotencyRecord(c context.Context, key string) (types.IdempotencyRecord, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "idempotencyKey",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+	}
+
+	result, err := d.client.GetItem(c, input)
+
+	if err != nil {
+		return types.IdempotencyRecord{}, err
+	}
+
+	if len(result.Item) == 0 {
+		return types.IdempotencyRecord{}, fmt.Errorf("idempotency key %w", types.ErrNotFound)
+	}
+
+	var record types.IdempotencyRecord
+	err = attributevalue.UnmarshalMap(result.Item, &record)
+
+	if err != nil {
+		return types.IdempotencyRecord{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	// the record is still in the table, but its window already expired
+	if record.ExpiresAt < time.Now().Unix() {
+		return types.IdempotencyRecord{}, fmt.Errorf("idempotency key %w", types.ErrNotFound)
+	}
+
+	return record, nil
+}
+
+func (d *DynamoDBStore) CompleteIdempotencyKey(c context.Context, record types.IdempotencyRecord) error {
+	record.EntityType = "idempotencyKey"
+	av, err := attributevalue.MarshalMap(record)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put idempotency record, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) ReleaseIdempotencyKey(c context.Context, key string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "idempotencyKey",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+	}
+
+	_, err := d.client.DeleteItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency record, %v", err)
+	}
+
+	return nil
+}
+
+// ************************************************************
+// SESSION METHODS
+// ************************************************************
+
+func (d *DynamoDBStore) PutRefreshToken(c context.Context, token types.RefreshToken) error {
+	token.EntityType = "refreshToken"
+	av, err := attributevalue.MarshalMap(token)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put refresh token, %v", err)
+	}
+
+	return nil
+}
+
+// the token is deleted in the same request that reads it, so two refreshes with the same token can't both succeed
+func (d *DynamoDBStore) ConsumeRefreshToken(c context.Context, hash string) (types.RefreshToken, error) {
+	input := &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "refreshToken",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: hash,
+			},
+		},
+		ReturnValues: ddbtypes.ReturnValueAllOld,
+	}
+
+	result, err := d.client.DeleteItem(c, input)
+
+	if err != nil {
+		return types.RefreshToken{}, fmt.Errorf("failed to delete refresh token, %v", err)
+	}
+
+	if len(result.Attributes) == 0 {
+		return types.RefreshToken{}, fmt.Errorf("refresh token %w", types.ErrNotFound)
+	}
+
+	var token types.RefreshToken
+	err = attributevalue.UnmarshalMap(result.Attributes, &token)
+
+	if err != nil {
+		return types.RefreshToken{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	// the TTL deletion is not immediate
+	if token.ExpiresAt < time.Now().Unix() {
+		return types.RefreshToken{}, fmt.Errorf("refresh token %w", types.ErrNotFound)
+	}
+
+	return token, nil
+}
+
+func (d *DynamoDBStore) RevokeToken(c context.Context, tokenId string, expiresAt time.Time) error {
+	revoked := types.RevokedToken{
+		TokenId:   tokenId,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	revoked.EntityType = "revokedToken"
+
+	av, err := attributevalue.MarshalMap(revoked)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal revoked token, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put revoked token, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) RevokeAllSessions(c context.Context, role string, username string, at time.Time) error {
+	revocation := types.SessionRevocation{
+		Id:        sessionRevocationId(role, username),
+		RevokedAt: at.UTC(),
+		// after this, every token issued before the revocation is expired anyway
+		ExpiresAt: at.Add(types.RefreshTokenTTL()).Unix(),
+	}
+	revocation.EntityType = "sessionRevocation"
+
+	av, err := attributevalue.MarshalMap(revocation)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal session revocation, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put session revocation, %v", err)
+	}
+
+	return nil
+}
+
+// both checks are done with a single BatchGetItem request, because this runs on every authenticated request
+func (d *DynamoDBStore) IsSessionRevoked(c context.Context, principal types.Principal) (bool, error) {
+	keys := []map[string]ddbtypes.AttributeValue{
+		{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "sessionRevocation",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: sessionRevocationId(principal.Role, principal.Username),
+			},
+		},
+	}
+
+	if principal.TokenId != "" {
+		keys = append(keys, map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "revokedToken",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: principal.TokenId,
+			},
+		})
+	}
+
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]ddbtypes.KeysAndAttributes{
+			d.tableName: {
+				Keys: keys,
+			},
+		},
+	}
+
+	result, err := d.client.BatchGetItem(c, input)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get revoked sessions, %v", err)
+	}
+
+	// don't accept the token if one of the checks couldn't be done
+	if len(result.UnprocessedKeys) > 0 {
+		return false, fmt.Errorf("failed to get revoked sessions, the request was throttled")
+	}
+
+	for _, item := range result.Responses[d.tableName] {
+		entityType, _ := item["entityType"].(*ddbtypes.AttributeValueMemberS)
+
+		if entityType == nil || entityType.Value != "sessionRevocation" {
+			// the jti is in the deny-list
+			return true, nil
+		}
+
+		var revocation types.SessionRevocation
+		err = attributevalue.UnmarshalMap(item, &revocation)
+
+		if err != nil {
+			return false, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+		}
+
+		if isRevokedBy(principal, revocation) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ************************************************************
+// ONE-TIME TOKEN METHODS
+// ************************************************************
+
+func oneTimeTokenId(purpose string, hash string) string {
+	return purpose + "#" + hash
+}
+
+func (d *DynamoDBStore) PutOneTimeToken(c context.Context, token types.OneTimeToken) error {
+	token.EntityType = "oneTimeToken"
+	token.Id = oneTimeTokenId(token.Purpose, token.Id)
+
+	av, err := attributevalue.MarshalMap(token)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal one-time token, %v", err)
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: &d.tableName,
+		Item:      av,
+	}
+
+	_, err = d.client.PutItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to put one-time token, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) ConsumeOneTimeToken(c context.Context, purpose string, hash string) (types.OneTimeToken, error) {
+	input := &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "oneTimeToken",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: oneTimeTokenId(purpose, hash),
+			},
+		},
+		ReturnValues: ddbtypes.ReturnValueAllOld,
+	}
+
+	result, err := d.client.DeleteItem(c, input)
+
+	if err != nil {
+		return types.OneTimeToken{}, fmt.Errorf("failed to delete one-time token, %v", err)
+	}
+
+	if len(result.Attributes) == 0 {
+		return types.OneTimeToken{}, fmt.Errorf("token %w", types.ErrNotFound)
+	}
+
+	var token types.OneTimeToken
+	err = attributevalue.UnmarshalMap(result.Attributes, &token)
+
+	if err != nil {
+		return types.OneTimeToken{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	// the TTL deletion is not immediate
+	if token.ExpiresAt < time.Now().Unix() {
+		return types.OneTimeToken{}, fmt.Errorf("token %w", types.ErrNotFound)
+	}
+
+	return token, nil
+}
+
+// ************************************************************
+// LOGIN ATTEMPT METHODS
+// ************************************************************
+
+// the counter is incremented with a single conditional ADD, so every concurrent attempt gets its own count.
+// The attempts are not counted while the key is locked
+func (d *DynamoDBStore) RecordLoginAttempt(c context.Context, key string, at time.Time, expiresAt time.Time) (types.LoginAttempts, error) {
+	lastAttemptAt, err := attributevalue.Marshal(at.UTC())
+
+	if err != nil {
+		return types.LoginAttempts{}, fmt.Errorf("failed to marshal login attempt, %v", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "loginAttempts",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+		UpdateExpression:    aws.String("ADD failures :one SET lastAttemptAt = :at, #ttl = :ttl"),
+		ConditionExpression: aws.String("attribute_not_exists(id) OR (#ttl >= :now AND (attribute_not_exists(lockedUntil) OR lockedUntil <= :now))"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": "ttl",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":one": &ddbtypes.AttributeValueMemberN{Value: "1"},
+			":at":  lastAttemptAt,
+			":ttl": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+			":now": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(at.Unix(), 10)},
+		},
+		ReturnValues:                        ddbtypes.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: ddbtypes.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	result, err := d.client.UpdateItem(c, input)
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		var current types.LoginAttempts
+		err = attributevalue.UnmarshalMap(conditionFailed.Item, &current)
+
+		if err != nil {
+			return types.LoginAttempts{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+		}
+
+		if current.ExpiresAt >= at.Unix() {
+			return current, fmt.Errorf("login %w", types.ErrLoginLocked)
+		}
+
+		// an expired counter that the table didn't delete yet starts again from one
+		return d.restartLoginAttempts(c, current, at, expiresAt)
+	} else if err != nil {
+		return types.LoginAttempts{}, fmt.Errorf("failed to update login attempts, %v", err)
+	}
+
+	var attempts types.LoginAttempts
+	err = attributevalue.UnmarshalMap(result.Attributes, &attempts)
+
+	if err != nil {
+		return types.LoginAttempts{}, fmt.Errorf("failed to unmarshal data from DynamoDB: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// replaces the expired counter. If another attempt replaced it first, this one is counted on the new counter
+func (d *DynamoDBStore) restartLoginAttempts(c context.Context, expired types.LoginAttempts, at time.Time, expiresAt time.Time) (types.LoginAttempts, error) {
+	attempts := types.LoginAttempts{
+		Key:           expired.Key,
+		Failures:      1,
+		LastAttemptAt: at.UTC(),
+		ExpiresAt:     expiresAt.Unix(),
+	}
+	attempts.EntityType = "loginAttempts"
+
+	av, err := attributevalue.MarshalMap(attempts)
+
+	if err != nil {
+		return types.LoginAttempts{}, fmt.Errorf("failed to marshal login attempts, %v", err)
+	}
+
+	_, err = d.client.PutItem(c, &dynamodb.PutItemInput{
+		TableName:           &d.tableName,
+		Item:                av,
+		ConditionExpression: aws.String("#ttl = :expired"),
+		ExpressionAttributeNames: map[string]string{
+			"#ttl": "ttl",
+		},
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":expired": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(expired.ExpiresAt, 10)},
+		},
+	})
+
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return d.RecordLoginAttempt(c, expired.Key, at, expiresAt)
+	} else if err != nil {
+		return types.LoginAttempts{}, fmt.Errorf("failed to put login attempts, %v", err)
+	}
+
+	return attempts, nil
+}
+
+// the failures counted until now (including the concurrent attempts) are the ones of the lockout
+func (d *DynamoDBStore) LockLogin(c context.Context, key string, failures int, until time.Time) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "loginAttempts",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+		UpdateExpression:    aws.String("SET lockedUntil = :until, lockedFailures = failures"),
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(lockedFailures) OR lockedFailures < :failures)"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":until":    &ddbtypes.AttributeValueMemberN{Value: strconv.FormatInt(until.Unix(), 10)},
+			":failures": &ddbtypes.AttributeValueMemberN{Value: strconv.Itoa(failures)},
+		},
+	}
+
+	_, err := d.client.UpdateItem(c, input)
+
+	// a later attempt locked it already
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to lock login, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) ReleaseLoginAttempt(c context.Context, key string) error {
+	input := &dynamodb.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "loginAttempts",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+		UpdateExpression:    aws.String("ADD failures :minusOne"),
+		ConditionExpression: aws.String("failures > :zero AND (attribute_not_exists(lockedFailures) OR failures > lockedFailures)"),
+		ExpressionAttributeValues: map[string]ddbtypes.AttributeValue{
+			":minusOne": &ddbtypes.AttributeValueMemberN{Value: "-1"},
+			":zero":     &ddbtypes.AttributeValueMemberN{Value: "0"},
+		},
+	}
+
+	_, err := d.client.UpdateItem(c, input)
+
+	// nothing to take back
+	var conditionFailed *ddbtypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to release login attempt, %v", err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBStore) ClearLoginAttempts(c context.Context, key string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: &d.tableName,
+		Key: map[string]ddbtypes.AttributeValue{
+			"entityType": &ddbtypes.AttributeValueMemberS{
+				Value: "loginAttempts",
+			},
+			"id": &ddbtypes.AttributeValueMemberS{
+				Value: key,
+			},
+		},
+	}
+
+	_, err := d.client.DeleteItem(c, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete login attempts, %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"OriD19/webdev2/types"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// a purchase transaction canceled by the condition of the coupon update, with the coupon as it was
+func canceledPurchase(t *testing.T, coupon types.Coupon) error {
+	item, err := attributevalue.MarshalMap(coupon)
+
+	if err != nil {
+		t.Fatalf("failed to marshal coupon: %v", err)
+	}
+
+	return &ddbtypes.TransactionCanceledException{
+		CancellationReasons: []ddbtypes.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed"), Item: item},
+			{Code: aws.String("None")},
+			{Code: aws.String("None")},
+		},
+	}
+}
+
+func TestPurchaseError(t *testing.T) {
+	onSale := types.Coupon{
+		Id:          "coupon-1",
+		CouponState: types.CouponStateActive,
+		ValidFrom:   time.Now().Add(-time.Hour),
+		ValidUntil:  time.Now().Add(24 * time.Hour),
+	}
+
+	soldOut := onSale
+	soldOut.AvailableCoupons = 0
+
+	// an unlimited coupon changed to a limited stock while it was being bought
+	changed := onSale
+	changed.AvailableCoupons = 10
+
+	inactive := onSale
+	inactive.AvailableCoupons = types.UnlimitedCoupons
+	inactive.CouponState = types.CouponStateInactive
+
+	tests := []struct {
+		name   string
+		coupon types.Coupon
+		want   error
+	}{
+		{"sold out", soldOut, types.ErrSoldOut},
+		{"stock mode changed", changed, types.ErrConflict},
+		{"unlimited but inactive", inactive, types.ErrInvalidState},
+	}
+
+	for _, test := range tests {
+		err := purchaseError(canceledPurchase(t, test.coupon))
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+
+	// without the coupon item, the failed condition of the coupon can only mean it is sold out
+	err := purchaseError(&ddbtypes.TransactionCanceledException{
+		CancellationReasons: []ddbtypes.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed")},
+			{Code: aws.String("None")},
+			{Code: aws.String("None")},
+		},
+	})
+
+	if !errors.Is(err, types.ErrSoldOut) {
+		t.Errorf("without the item: expected %v, got %v", types.ErrSoldOut, err)
+	}
+}
+
+func TestPurchaseErrorLimitReached(t *testing.T) {
+	err := purchaseError(&ddbtypes.TransactionCanceledException{
+		CancellationReasons: []ddbtypes.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed")},
+		},
+	})
+
+	if !errors.Is(err, types.ErrPurchaseLimit) {
+		t.Errorf("expected %v, got %v", types.ErrPurchaseLimit, err)
+	}
+}
+
+var expressionValueName = regexp.MustCompile(`:[A-Za-z]+`)
+
+// DynamoDB rejects the requests with values that are not used by any expression, and the other way around
+func checkExpressionValues(t *testing.T, name string, values map[string]ddbtypes.AttributeValue, expressions ...*string) {
+	used := map[string]bool{}
+
+	for _, expression := range expressions {
+		for _, value := range expressionValueName.FindAllString(aws.ToString(expression), -1) {
+			used[value] = true
+		}
+	}
+
+	for value := range values {
+		if !used[value] {
+			t.Errorf("%s: %s is sent but not used", name, value)
+		}
+	}
+
+	for value := range used {
+		if _, ok := values[value]; !ok {
+			t.Errorf("%s: %s is used but not sent", name, value)
+		}
+	}
+}
+
+func TestPurchaseTransactionExpressionValues(t *testing.T) {
+	now := &ddbtypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+
+	limited := types.Coupon{Id: "coupon-1", AvailableCoupons: 10}
+
+	unlimited := limited
+	unlimited.AvailableCoupons = types.UnlimitedCoupons
+
+	limitedPerClient := limited
+	limitedPerClient.MaxPerClient = 2
+
+	unlimitedPerClient := unlimited
+	unlimitedPerClient.MaxPerClient = 2
+
+	tests := []struct {
+		name   string
+		coupon types.Coupon
+	}{
+		{"limited", limited},
+		{"unlimited", unlimited},
+		{"limited with a limit per client", limitedPerClient},
+		{"unlimited with a limit per client", unlimitedPerClient},
+	}
+
+	for _, test := range tests {
+		input := purchaseTransaction("table", test.coupon, "client-1", map[string]ddbtypes.AttributeValue{}, now)
+
+		for i, item := range input.TransactItems {
+			if item.Update == nil {
+				continue
+			}
+
+			checkExpressionValues(t, fmt.Sprintf("%s, item %d", test.name, i), item.Update.ExpressionAttributeValues,
+				item.Update.UpdateExpression, item.Update.ConditionExpression)
+		}
+	}
+
+	stock := purchaseTransaction("table", unlimited, "client-1", nil, now).TransactItems[0].Update
+
+	if aws.ToString(stock.UpdateExpression) != "ADD soldCoupons :one" {
+		t.Errorf("expected the unlimited coupons to only count the sales, got %s", aws.ToString(stock.UpdateExpression))
+	}
+}
+
+func TestPurchaseTransactionStockCondition(t *testing.T) {
+	now := &ddbtypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)}
+
+	stock := purchaseTransaction("table", types.Coupon{Id: "coupon-1", AvailableCoupons: 10}, "client-1", nil, now).TransactItems[0].Update
+	condition := aws.ToString(stock.ConditionExpression)
+
+	// the stock is checked in the same write that takes a coupon, so two purchases can't both take the last one
+	if !strings.Contains(condition, "availableCoupons > :zero") {
+		t.Errorf("expected the limited stock to be checked, got %s", condition)
+	}
+
+	if !strings.Contains(aws.ToString(stock.UpdateExpression), "availableCoupons = availableCoupons - :one") {
+		t.Errorf("expected the stock to be decremented, got %s", aws.ToString(stock.UpdateExpression))
+	}
+}
+
+func TestUserUpdateInput(t *testing.T) {
+	disabled := true
+	reason := "spam"
+	email := "new@example.com"
+	oldEmail := "old@example.com"
+
+	input, err := userUpdateInput("table", "client", "client-1", types.UserUpdate{
+		Disabled:       &disabled,
+		DisabledReason: &reason,
+		Email:          &email,
+		IfEmail:        &oldEmail,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checkExpressionValues(t, "user update", input.ExpressionAttributeValues, input.UpdateExpression, input.ConditionExpression)
+
+	update := aws.ToString(input.UpdateExpression)
+
+	for _, attribute := range []string{"password", "firstName", "emailState"} {
+		if strings.Contains(update, attribute) {
+			t.Errorf("expected %s to be left as it is, got %s", attribute, update)
+		}
+	}
+
+	if !strings.Contains(aws.ToString(input.ConditionExpression), "email = :ifEmail") {
+		t.Errorf("expected the update to be conditioned on the old email, got %s", aws.ToString(input.ConditionExpression))
+	}
+
+	_, err = userUpdateInput("table", "client", "client-1", types.UserUpdate{})
+
+	if !errors.Is(err, types.ErrValidation) {
+		t.Errorf("expected an empty update to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,996 @@
+package database
+
+// In-memory implementation of the stores, for local development and tests.
+// It mimics the behavior of the DynamoDBStore (pagination, not found errors, etc)
+
+import (
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/types"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// the memory store can replace the DynamoDB store anywhere
+var (
+	_ types.CouponStore       = (*MemoryStore)(nil)
+	_ types.UserStore         = (*MemoryStore)(nil)
+	_ types.IdempotencyStore  = (*MemoryStore)(nil)
+	_ types.SessionStore      = (*MemoryStore)(nil)
+	_ types.OneTimeTokenStore = (*MemoryStore)(nil)
+	_ types.LoginAttemptStore = (*MemoryStore)(nil)
+)
+
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	coupons        map[string]types.Coupon
+	offers         map[string]types.GeneratedOffer
+	clients        map[string]types.Client
+	enterprises    map[string]types.Enterprise
+	administrators map[string]types.Administrator
+	employees      map[string]types.Employee
+
+	enterpriseCodes map[string]string // code -> enterprise id
+	purchases       map[string]int    // coupon#client -> coupons bought
+	idempotencyKeys map[string]types.IdempotencyRecord
+
+	refreshTokens      map[string]types.RefreshToken
+	revokedTokens      map[string]time.Time // jti -> expiration of the token
+	sessionRevocations map[string]types.SessionRevocation
+
+	oneTimeTokens map[string]types.OneTimeToken
+	loginAttempts map[string]types.LoginAttempts
+
+	cursors *pagination.Codec
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		coupons:        map[string]types.Coupon{},
+		offers:         map[string]types.GeneratedOffer{},
+		clients:        map[string]types.Client{},
+		enterprises:    map[string]types.Enterprise{},
+		administrators: map[string]types.Administrator{},
+		employees:      map[string]types.Employee{},
+
+		enterpriseCodes: map[string]string{},
+		purchases:       map[string]int{},
+		idempotencyKeys: map[string]types.IdempotencyRecord{},
+
+		refreshTokens:      map[string]types.RefreshToken{},
+		revokedTokens:      map[string]time.Time{},
+		sessionRevocations: map[string]types.SessionRevocation{},
+
+		oneTimeTokens: map[string]types.OneTimeToken{},
+		loginAttempts: map[string]types.LoginAttempts{},
+
+		cursors: pagination.NewLocalCodec(),
+	}
+}
+
+// ************************************************************
+// COUPON METHODS
+// ************************************************************
+
+func (m *MemoryStore) GetAllCoupons(ctx context.Context, nextToken *string, limit int32) (types.CouponRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.paginateCoupons(allCouponsScope, isPublicCoupon, nextToken, limit)
+}
+
+func (m *MemoryStore) GetAllCouponsFromCategory(ctx context.Context, category string, nextToken *string, limit int32) (types.CouponRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.paginateCoupons(categoryScope(category), func(c types.Coupon) bool { return c.Category == category && isPublicCoupon(c) }, nextToken, limit)
+}
+
+// same condition as the publicCouponsFilter of the DynamoDB store
+func isPublicCoupon(coupon types.Coupon) bool {
+	return coupon.IsOnSale(time.Now())
+}
+
+// return a single page of the coupons that match the given condition, ordered by their id
+// (DynamoDB returns the items of a partition ordered by their sort key)
+func (m *MemoryStore) paginateCoupons(scope string, match func(types.Coupon) bool, nextToken *string, limit int32) (types.CouponRange, error) {
+	couponRange := types.CouponRange{
+		Coupons: []types.Coupon{},
+	}
+
+	ids := make([]string, 0, len(m.coupons))
+	for id, coupon := range m.coupons {
+		if match(coupon) {
+			ids = append(ids, id)
+		}
+	}
+
+	page, next, err := m.paginateIds(scope, "coupon", ids, nextToken, limit)
+
+	if err != nil {
+		return couponRange, err
+	}
+
+	for _, id := range page {
+		couponRange.Coupons = append(couponRange.Coupons, m.coupons[id])
+	}
+
+	couponRange.Next = next
+
+	return couponRange, nil
+}
+
+// sort the ids and return the ones of the requested page, with the cursor for the next one
+func (m *MemoryStore) paginateIds(scope string, entityType string, ids []string, nextToken *string, limit int32) ([]string, *string, error) {
+	sort.Strings(ids)
+
+	start := 0
+	if nextToken != nil {
+		startKey, err := m.cursors.Decode(scope, *nextToken)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// the key is exclusive, just like the ExclusiveStartKey
+		startId := stringKey(startKey, "id")
+		start = sort.Search(len(ids), func(i int) bool {
+			return ids[i] > startId
+		})
+	}
+
+	end := min(start+int(limit), len(ids))
+
+	if end >= len(ids) {
+		return ids[start:end], nil, nil
+	}
+
+	lastKey := map[string]ddbtypes.AttributeValue{
+		"entityType": &ddbtypes.AttributeValueMemberS{Value: entityType},
+		"id":         &ddbtypes.AttributeValueMemberS{Value: ids[end-1]},
+	}
+
+	next, err := m.cursors.Encode(scope, lastKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ids[start:end], next, nil
+}
+
+// read a string attribute from a key decoded from a cursor
+func stringKey(key map[string]ddbtypes.AttributeValue, name string) string {
+	if value, ok := key[name].(*ddbtypes.AttributeValueMemberS); ok {
+		return value.Value
+	}
+
+	return ""
+}
+
+func (m *MemoryStore) GetCoupon(c context.Context, id string) (types.Coupon, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	coupon, ok := m.coupons[id]
+
+	if !ok {
+		return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+	}
+
+	return coupon, nil
+}
+
+func (m *MemoryStore) PutCoupon(c context.Context, coupon types.Coupon) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	coupon.EntityType = "coupon"
+	m.coupons[coupon.Id] = coupon
+
+	return nil
+}
+
+func (m *MemoryStore) UpdateCouponState(c context.Context, id string, transition types.CouponTransition) (types.Coupon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	coupon, ok := m.coupons[id]
+
+	if !ok {
+		return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+	}
+
+	if coupon.CouponState != transition.From {
+		return types.Coupon{}, fmt.Errorf("coupon is no longer %s: %w", transition.From, types.ErrInvalidState)
+	}
+
+	coupon.CouponState = transition.To
+	// copy the history, so the coupons returned before are not modified
+	coupon.StateHistory = append(slices.Clone(coupon.StateHistory), transition)
+	m.coupons[id] = coupon
+
+	return coupon, nil
+}
+
+func (m *MemoryStore) UpdateCoupon(c context.Context, id string, update types.CouponUpdate) (types.Coupon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	coupon, ok := m.coupons[id]
+
+	if !ok {
+		return types.Coupon{}, fmt.Errorf("coupon %w", types.ErrNotFound)
+	}
+
+	switch coupon.CouponState {
+	case types.CouponStatePending, types.CouponStateActive, types.CouponStateInactive:
+	default:
+		return types.Coupon{}, fmt.Errorf("expired or rejected coupons can't be edited: %w", types.ErrInvalidState)
+	}
+
+	if !coupon.ValidUntil.After(time.Now()) {
+		return types.Coupon{}, fmt.Errorf("expired or rejected coupons can't be edited: %w", types.ErrInvalidState)
+	}
+
+	if update.Title != nil {
+		coupon.Title = *update.Title
+	}
+
+	if update.RegularPrice != nil {
+		coupon.RegularPrice = *update.RegularPrice
+	}
+
+	if update.OfferPrice != nil {
+		coupon.OfferPrice = *update.OfferPrice
+	}
+
+	if update.ValidUntil != nil {
+		coupon.ValidUntil = update.ValidUntil.UTC()
+	}
+
+	if update.OfferDesc != nil {
+		coupon.OfferDesc = *update.OfferDesc
+	}
+
+	if update.MaxPerClient != nil {
+		coupon.MaxPerClient = *update.MaxPerClient
+	}
+
+	m.coupons[id] = coupon
+
+	return coupon, nil
+}
+
+// generate a random ID for the generated offer. The caller must hold the lock
+func (m *MemoryStore) generateId(enterpriseId string) (string, error) {
+	// 7-digit random number for the code
+	randInt, err := rand.Int(rand.Reader, big.NewInt(9999999))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random number, %v", err)
+	}
+
+	enterprise, ok := m.enterprises[enterpriseId]
+
+	if !ok {
+		return "", fmt.Errorf("failed to get enterprise: enterprise %w", types.ErrNotFound)
+	}
+
+	return fmt.Sprintf("%s%d", enterprise.EnterpriseCode, randInt), nil
+}
+
+// only clients can buy a coupon
+func (m *MemoryStore) BuyCoupon(c context.Context, couponId string, userId string) (types.GeneratedOffer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	coupon, ok := m.coupons[couponId]
+
+	if !ok {
+		return types.GeneratedOffer{}, fmt.Errorf("failed to get coupon: coupon %w", types.ErrNotFound)
+	}
+
+	if !isPublicCoupon(coupon) {
+		return types.GeneratedOffer{}, fmt.Errorf("coupon is not available for purchase: %w", types.ErrInvalidState)
+	}
+
+	// the lock is held for the whole purchase, so this check and the decrement are atomic
+	if !coupon.IsUnlimited() && coupon.AvailableCoupons <= 0 {
+		return types.GeneratedOffer{}, types.ErrSoldOut
+	}
+
+	user, ok := m.clients[userId]
+
+	if !ok {
+		return types.GeneratedOffer{}, fmt.Errorf("failed to get user: client %w", types.ErrNotFound)
+	}
+
+	generatedId, err := m.generateId(coupon.EnterpriseId)
+
+	if err != nil {
+		return types.GeneratedOffer{}, fmt.Errorf("failed to generate ID: %w", err)
+	}
+
+	var newGenOffer types.GeneratedOffer
+
+	newGenOffer.EntityType = "generatedOffer"
+	newGenOffer.Id = generatedId
+	newGenOffer.UserId = user.Username // username as the ID of the user
+	newGenOffer.CouponId = coupon.Id
+	newGenOffer.EnterpriseId = coupon.EnterpriseId
+	newGenOffer.GeneratedAt = time.Now()
+	newGenOffer.ExpirationDate = coupon.ValidUntil
+	newGenOffer.Redeemed = false
+	newGenOffer.RegularPrice = coupon.RegularPrice
+	newGenOffer.OfferPrice = coupon.OfferPrice
+
+	if _, exists := m.offers[newGenOffer.Id]; exists {
+		return types.GeneratedOffer{}, fmt.Errorf("failed to buy coupon: %w", types.ErrConflict)
+	}
+
+	purchasesId := couponPurchasesId(coupon.Id, user.Username)
+
+	if coupon.MaxPerClient > 0 && m.purchases[purchasesId] >= coupon.MaxPerClient {
+		return types.GeneratedOffer{}, types.ErrPurchaseLimit
+	}
+
+	m.offers[newGenOffer.Id] = newGenOffer
+	m.purchases[purchasesId]++
+
+	// decrease the count of available coupons. The unlimited coupons only count the sales
+	if !coupon.IsUnlimited() {
+		coupon.AvailableCoupons--
+	}
+
+	coupon.SoldCoupons++
+	m.coupons[coupon.Id] = coupon
+
+	return newGenOffer, nil
+}
+
+func (m *MemoryStore) GetUserOffers(c context.Context, userId string, query types.OfferQuery) (types.OfferRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	offers := types.OfferRange{
+		Offers: []types.GeneratedOffer{},
+	}
+
+	now := time.Now()
+	userOffers := []types.GeneratedOffer{}
+
+	for _, offer := range m.offers {
+		if offer.UserId != userId {
+			continue
+		}
+
+		expired := !offer.ExpirationDate.After(now)
+
+		switch query.Status {
+		case "":
+		case types.OfferStatusActive:
+			if offer.Redeemed || expired {
+				continue
+			}
+		case types.OfferStatusExpired:
+			if offer.Redeemed || !expired {
+				continue
+			}
+		case types.OfferStatusRedeemed:
+			if !offer.Redeemed {
+				continue
+			}
+		default:
+			return offers, fmt.Errorf("unknown offer status %s", query.Status)
+		}
+
+		userOffers = append(userOffers, offer)
+	}
+
+	// same order as the index: by purchase date, and then by id
+	sort.Slice(userOffers, func(i, j int) bool {
+		return offerKey(userOffers[i]) < offerKey(userOffers[j]) == query.Ascending
+	})
+
+	start := 0
+	if query.Next != nil {
+		startKey, err := m.cursors.Decode(userOffersScope(userId), *query.Next)
+
+		if err != nil {
+			return offers, err
+		}
+
+		startOffer := stringKey(startKey, "generatedAt") + "#" + stringKey(startKey, "id")
+		start = sort.Search(len(userOffers), func(i int) bool {
+			if query.Ascending {
+				return offerKey(userOffers[i]) > startOffer
+			}
+
+			return offerKey(userOffers[i]) < startOffer
+		})
+	}
+
+	end := min(start+int(query.Limit), len(userOffers))
+	offers.Offers = append(offers.Offers, userOffers[start:end]...)
+
+	if end < len(userOffers) {
+		last := userOffers[end-1]
+		lastKey := map[string]ddbtypes.AttributeValue{
+			"userId":      &ddbtypes.AttributeValueMemberS{Value: userId},
+			"generatedAt": &ddbtypes.AttributeValueMemberS{Value: last.GeneratedAt.UTC().Format(time.RFC3339Nano)},
+			"entityType":  &ddbtypes.AttributeValueMemberS{Value: "generatedOffer"},
+			"id":          &ddbtypes.AttributeValueMemberS{Value: last.Id},
+		}
+
+		next, err := m.cursors.Encode(userOffersScope(userId), lastKey)
+
+		if err != nil {
+			return offers, err
+		}
+
+		offers.Next = next
+	}
+
+	return offers, nil
+}
+
+// sort key of an offer inside the memory store: <generatedAt>#<offerId>
+func offerKey(offer types.GeneratedOffer) string {
+	return offer.GeneratedAt.UTC().Format(time.RFC3339Nano) + "#" + offer.Id
+}
+
+func (m *MemoryStore) GetGeneratedOffer(c context.Context, id string) (types.GeneratedOffer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	offer, ok := m.offers[id]
+
+	if !ok {
+		return types.GeneratedOffer{}, fmt.Errorf("offer %w", types.ErrNotFound)
+	}
+
+	return offer, nil
+}
+
+func (m *MemoryStore) GetEnterpriseCoupons(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.CouponRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	match := func(coupon types.Coupon) bool { return coupon.EnterpriseId == enterpriseId }
+
+	return m.paginateCoupons(enterpriseScope(enterpriseId, "coupon"), match, nextToken, limit)
+}
+
+func (m *MemoryStore) GetEnterpriseOffers(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.OfferRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	offers := types.OfferRange{
+		Offers: []types.GeneratedOffer{},
+	}
+
+	ids := []string{}
+	for id, offer := range m.offers {
+		if offer.EnterpriseId == enterpriseId {
+			ids = append(ids, id)
+		}
+	}
+
+	page, next, err := m.paginateIds(enterpriseScope(enterpriseId, "generatedOffer"), "generatedOffer", ids, nextToken, limit)
+
+	if err != nil {
+		return offers, err
+	}
+
+	for _, id := range page {
+		offers.Offers = append(offers.Offers, m.offers[id])
+	}
+
+	offers.Next = next
+
+	return offers, nil
+}
+
+func (m *MemoryStore) RedeemCoupon(c context.Context, id string, employee types.Employee) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offer, ok := m.offers[id]
+
+	if !ok {
+		return fmt.Errorf("offer %w", types.ErrNotFound)
+	}
+
+	// check if the offer is already redeemed
+	if offer.Redeemed {
+		return types.ErrAlreadyRedeemed
+	}
+
+	now := time.Now()
+
+	// check if the offer is still valid
+	if !offer.ExpirationDate.After(now) {
+		return types.ErrExpired
+	}
+
+	offer.Redeemed = true
+	offer.RedeemedAt = &now
+	offer.RedeemedBy = employee.Username
+	offer.RedeemedAtEnterprise = employee.EnterpriseId
+	m.offers[offer.Id] = offer
+
+	return nil
+}
+
+// ************************************************************
+// USER METHODS
+// ************************************************************
+
+// !IMPORTANT: REGISTER METHODS ALSO UPDATES IF THE VALUE ALREADY EXISTS
+func (m *MemoryStore) RegisterClient(c context.Context, client types.Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client.EntityType = "client"
+	m.clients[client.Username] = client
+
+	return nil
+}
+
+func (m *MemoryStore) RegisterEnterprise(c context.Context, enterprise types.Enterprise) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enterprise.EntityType = "enterprise"
+	m.enterprises[enterprise.Username] = enterprise
+
+	return nil
+}
+
+func (m *MemoryStore) RegisterAdministrator(c context.Context, administrator types.Administrator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	administrator.EntityType = "administrator"
+	m.administrators[administrator.Username] = administrator
+
+	return nil
+}
+
+func (m *MemoryStore) RegisterEmployee(c context.Context, employee types.Employee) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	employee.EntityType = "employee"
+	m.employees[employee.Username] = employee
+
+	return nil
+}
+
+func (m *MemoryStore) GetClient(c context.Context, username string) (types.Client, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	client, ok := m.clients[username]
+
+	if !ok {
+		return types.Client{}, fmt.Errorf("client %w", types.ErrNotFound)
+	}
+
+	return client, nil
+}
+
+func (m *MemoryStore) GetEnterprise(c context.Context, id string) (types.Enterprise, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	enterprise, ok := m.enterprises[id]
+
+	if !ok {
+		return types.Enterprise{}, fmt.Errorf("enterprise %w", types.ErrNotFound)
+	}
+
+	return enterprise, nil
+}
+
+func (m *MemoryStore) ReserveEnterpriseCode(c context.Context, code string, enterpriseId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, taken := m.enterpriseCodes[code]; taken {
+		return fmt.Errorf("enterprise code %s is already in use: %w", code, types.ErrConflict)
+	}
+
+	m.enterpriseCodes[code] = enterpriseId
+
+	return nil
+}
+
+func (m *MemoryStore) ListEnterprises(c context.Context, nextToken *string, limit int32) (types.EnterpriseRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	enterpriseRange := types.EnterpriseRange{
+		Enterprises: []types.Enterprise{},
+	}
+
+	ids := make([]string, 0, len(m.enterprises))
+	for id := range m.enterprises {
+		ids = append(ids, id)
+	}
+
+	page, next, err := m.paginateIds(enterprisesScope, "enterprise", ids, nextToken, limit)
+
+	if err != nil {
+		return enterpriseRange, err
+	}
+
+	for _, id := range page {
+		enterpriseRange.Enterprises = append(enterpriseRange.Enterprises, m.enterprises[id])
+	}
+
+	enterpriseRange.Next = next
+
+	return enterpriseRange, nil
+}
+
+func (m *MemoryStore) GetAdministrator(c context.Context, id string) (types.Administrator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	administrator, ok := m.administrators[id]
+
+	if !ok {
+		return types.Administrator{}, fmt.Errorf("administrator %w", types.ErrNotFound)
+	}
+
+	return administrator, nil
+}
+
+func (m *MemoryStore) GetEmployee(c context.Context, id string) (types.Employee, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	employee, ok := m.employees[id]
+
+	if !ok {
+		return types.Employee{}, fmt.Errorf("employee %w", types.ErrNotFound)
+	}
+
+	return employee, nil
+}
+
+func (m *MemoryStore) UpdateClient(c context.Context, username string, update types.UserUpdate) (types.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, ok := m.clients[username]
+
+	if !ok {
+		return types.Client{}, fmt.Errorf("client %w", types.ErrNotFound)
+	}
+
+	if update.IfEmail != nil && client.Email != *update.IfEmail {
+		return types.Client{}, fmt.Errorf("the email of the client changed: %w", types.ErrConflict)
+	}
+
+	applyUserUpdate(&client.User, update)
+	setIfNotNil(&client.FirstName, update.FirstName)
+	setIfNotNil(&client.LastName, update.LastName)
+	setIfNotNil(&client.Address, update.Address)
+	setIfNotNil(&client.PhoneNumber, update.PhoneNumber)
+	setIfNotNil(&client.EmailState, update.EmailState)
+	m.clients[username] = client
+
+	return client, nil
+}
+
+func (m *MemoryStore) UpdateEmployee(c context.Context, username string, update types.UserUpdate) (types.Employee, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	employee, ok := m.employees[username]
+
+	if !ok {
+		return types.Employee{}, fmt.Errorf("employee %w", types.ErrNotFound)
+	}
+
+	if update.IfEmail != nil && employee.Email != *update.IfEmail {
+		return types.Employee{}, fmt.Errorf("the email of the employee changed: %w", types.ErrConflict)
+	}
+
+	applyUserUpdate(&employee.User, update)
+	m.employees[username] = employee
+
+	return employee, nil
+}
+
+func applyUserUpdate(user *types.User, update types.UserUpdate) {
+	setIfNotNil(&user.Password, update.Password)
+	setIfNotNil(&user.Email, update.Email)
+	setIfNotNil(&user.DisabledReason, update.DisabledReason)
+
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+}
+
+func setIfNotNil(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func (m *MemoryStore) GetEnterpriseEmployees(c context.Context, enterpriseId string, nextToken *string, limit int32) (types.EmployeeRange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	employees := types.EmployeeRange{
+		Employees: []types.Employee{},
+	}
+
+	ids := []string{}
+	for id, employee := range m.employees {
+		if employee.EnterpriseId == enterpriseId {
+			ids = append(ids, id)
+		}
+	}
+
+	page, next, err := m.paginateIds(enterpriseScope(enterpriseId, "employee"), "employee", ids, nextToken, limit)
+
+	if err != nil {
+		return employees, err
+	}
+
+	for _, id := range page {
+		employees.Employees = append(employees.Employees, m.employees[id])
+	}
+
+	employees.Next = next
+
+	return employees, nil
+}
+
+func (m *MemoryStore) DeleteEmployee(c context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.employees[id]; !ok {
+		return fmt.Errorf("employee %w", types.ErrNotFound)
+	}
+
+	delete(m.employees, id)
+
+	return nil
+}
+
+// ************************************************************
+// IDEMPOTENCY METHODS
+// ************************************************************
+
+func (m *MemoryStore) ReserveIdempotencyKey(c context.Context, record types.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.idempotencyKeys[record.Key]
+
+	if ok && existing.ExpiresAt >= time.Now().Unix() {
+		return fmt.Errorf("idempotency key already in use: %w", types.ErrConflict)
+	}
+
+	record.EntityType = "idempotencyKey"
+	m.idempotencyKeys[record.Key] = record
+
+	return nil
+}
+
+func (m *MemoryStore) GetIdempotencyRecord(c context.Context, key string) (types.IdempotencyRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.idempotencyKeys[key]
+
+	if !ok || record.ExpiresAt < time.Now().Unix() {
+		return types.IdempotencyRecord{}, fmt.Errorf("idempotency key %w", types.ErrNotFound)
+	}
+
+	return record, nil
+}
+
+func (m *MemoryStore) CompleteIdempotencyKey(c context.Context, record types.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record.EntityType = "idempotencyKey"
+	m.idempotencyKeys[record.Key] = record
+
+	return nil
+}
+
+func (m *MemoryStore) ReleaseIdempotencyKey(c context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotencyKeys, key)
+
+	return nil
+}
+
+// ************************************************************
+// SESSION METHODS
+// ************************************************************
+
+func (m *MemoryStore) PutRefreshToken(c context.Context, token types.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token.EntityType = "refreshToken"
+	m.refreshTokens[token.Hash] = token
+
+	return nil
+}
+
+func (m *MemoryStore) ConsumeRefreshToken(c context.Context, hash string) (types.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[hash]
+
+	if !ok {
+		return types.RefreshToken{}, fmt.Errorf("refresh token %w", types.ErrNotFound)
+	}
+
+	delete(m.refreshTokens, hash)
+
+	if token.ExpiresAt < time.Now().Unix() {
+		return types.RefreshToken{}, fmt.Errorf("refresh token %w", types.ErrNotFound)
+	}
+
+	return token, nil
+}
+
+func (m *MemoryStore) RevokeToken(c context.Context, tokenId string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokedTokens[tokenId] = expiresAt
+
+	return nil
+}
+
+func (m *MemoryStore) RevokeAllSessions(c context.Context, role string, username string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessionRevocations[sessionRevocationId(role, username)] = types.SessionRevocation{
+		Id:        sessionRevocationId(role, username),
+		RevokedAt: at.UTC(),
+		ExpiresAt: at.Add(types.RefreshTokenTTL()).Unix(),
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) IsSessionRevoked(c context.Context, principal types.Principal) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, revoked := m.revokedTokens[principal.TokenId]; principal.TokenId != "" && revoked {
+		return true, nil
+	}
+
+	revocation, ok := m.sessionRevocations[sessionRevocationId(principal.Role, principal.Username)]
+
+	return ok && isRevokedBy(principal, revocation), nil
+}
+
+// ************************************************************
+// ONE-TIME TOKEN METHODS
+// ************************************************************
+
+func (m *MemoryStore) PutOneTimeToken(c context.Context, token types.OneTimeToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token.EntityType = "oneTimeToken"
+	token.Id = oneTimeTokenId(token.Purpose, token.Id)
+	m.oneTimeTokens[token.Id] = token
+
+	return nil
+}
+
+func (m *MemoryStore) ConsumeOneTimeToken(c context.Context, purpose string, hash string) (types.OneTimeToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := oneTimeTokenId(purpose, hash)
+	token, ok := m.oneTimeTokens[id]
+
+	if !ok {
+		return types.OneTimeToken{}, fmt.Errorf("token %w", types.ErrNotFound)
+	}
+
+	delete(m.oneTimeTokens, id)
+
+	if token.ExpiresAt < time.Now().Unix() {
+		return types.OneTimeToken{}, fmt.Errorf("token %w", types.ErrNotFound)
+	}
+
+	return token, nil
+}
+
+// ************************************************************
+// LOGIN ATTEMPT METHODS
+// ************************************************************
+
+func (m *MemoryStore) RecordLoginAttempt(c context.Context, key string, at time.Time, expiresAt time.Time) (types.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.loginAttempts[key]
+
+	if !ok || attempts.ExpiresAt < at.Unix() {
+		attempts = types.LoginAttempts{Key: key}
+		attempts.EntityType = "loginAttempts"
+	} else if attempts.LockedUntil > at.Unix() {
+		return attempts, fmt.Errorf("login %w", types.ErrLoginLocked)
+	}
+
+	attempts.Failures++
+	attempts.LastAttemptAt = at.UTC()
+	attempts.ExpiresAt = expiresAt.Unix()
+	m.loginAttempts[key] = attempts
+
+	return attempts, nil
+}
+
+func (m *MemoryStore) LockLogin(c context.Context, key string, failures int, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.loginAttempts[key]
+
+	if !ok || attempts.LockedFailures >= failures {
+		return nil
+	}
+
+	attempts.LockedFailures = attempts.Failures
+	attempts.LockedUntil = until.Unix()
+	m.loginAttempts[key] = attempts
+
+	return nil
+}
+
+func (m *MemoryStore) ReleaseLoginAttempt(c context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.loginAttempts[key]
+
+	if !ok || attempts.Failures <= attempts.LockedFailures {
+		return nil
+	}
+
+	attempts.Failures--
+	m.loginAttempts[key] = attempts
+
+	return nil
+}
+
+func (m *MemoryStore) ClearLoginAttempts(c context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginAttempts, key)
+
+	return nil
+}
@@ -0,0 +1,428 @@
+package database
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreNotFound(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	checks := map[string]func() error{
+		"coupon": func() error {
+			_, err := store.GetCoupon(ctx, "missing")
+			return err
+		},
+		"offer": func() error {
+			_, err := store.GetGeneratedOffer(ctx, "missing")
+			return err
+		},
+		"client": func() error {
+			_, err := store.GetClient(ctx, "missing")
+			return err
+		},
+		"enterprise": func() error {
+			_, err := store.GetEnterprise(ctx, "missing")
+			return err
+		},
+		"administrator": func() error {
+			_, err := store.GetAdministrator(ctx, "missing")
+			return err
+		},
+		"employee": func() error {
+			_, err := store.GetEmployee(ctx, "missing")
+			return err
+		},
+		"buy a missing coupon": func() error {
+			_, err := store.BuyCoupon(ctx, "missing", "missing")
+			return err
+		},
+		"redeem a missing offer": func() error {
+			return store.RedeemCoupon(ctx, "missing", types.Employee{})
+		},
+	}
+
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, types.ErrNotFound) {
+			t.Errorf("%s: expected %v, got %v", name, types.ErrNotFound, err)
+		}
+	}
+}
+
+func TestMemoryStoreGetAllCouponsPagination(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	const total = 25
+
+	for i := 0; i < total; i++ {
+		store.PutCoupon(ctx, types.Coupon{
+			Id:          fmt.Sprintf("coupon-%02d", i),
+			CouponState: types.CouponStateActive,
+			ValidUntil:  time.Now().Add(24 * time.Hour),
+		})
+	}
+
+	var (
+		got       []string
+		pageSizes []int
+		next      *string
+	)
+
+	for {
+		page, err := store.GetAllCoupons(ctx, next, 10)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		pageSizes = append(pageSizes, len(page.Coupons))
+
+		for _, coupon := range page.Coupons {
+			got = append(got, coupon.Id)
+		}
+
+		if page.Next == nil {
+			break
+		}
+
+		next = page.Next
+	}
+
+	if fmt.Sprint(pageSizes) != "[10 10 5]" {
+		t.Errorf("expected pages of [10 10 5] coupons, got %v", pageSizes)
+	}
+
+	// every coupon once, in the order of their ids
+	for i, id := range got {
+		if want := fmt.Sprintf("coupon-%02d", i); id != want {
+			t.Fatalf("expected %s at position %d, got %s", want, i, id)
+		}
+	}
+
+	if len(got) != total {
+		t.Errorf("expected %d coupons, got %d", total, len(got))
+	}
+}
+
+func TestMemoryStoreBuyCouponAccounting(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	enterprise := types.Enterprise{EnterpriseCode: "TEST"}
+	enterprise.Username = "enterprise-1"
+	store.RegisterEnterprise(ctx, enterprise)
+
+	client := types.Client{}
+	client.Username = "client-1"
+	store.RegisterClient(ctx, client)
+
+	store.PutCoupon(ctx, types.Coupon{
+		Id:               "coupon-1",
+		RegularPrice:     20,
+		OfferPrice:       10,
+		AvailableCoupons: 2,
+		CouponState:      types.CouponStateActive,
+		ValidFrom:        time.Now().Add(-time.Hour),
+		ValidUntil:       time.Now().Add(24 * time.Hour),
+		EnterpriseId:     "enterprise-1",
+	})
+
+	// an unknown client doesn't take a coupon
+	if _, err := store.BuyCoupon(ctx, "coupon-1", "client-2"); err == nil {
+		t.Fatalf("expected an error for an unknown client")
+	}
+
+	for i := 0; i < 2; i++ {
+		offer, err := store.BuyCoupon(ctx, "coupon-1", "client-1")
+
+		if err != nil {
+			t.Fatalf("purchase %d: unexpected error: %v", i, err)
+		}
+
+		if offer.UserId != "client-1" || offer.CouponId != "coupon-1" || offer.OfferPrice != 10 || offer.RegularPrice != 20 {
+			t.Errorf("purchase %d: unexpected offer %+v", i, offer)
+		}
+	}
+
+	if _, err := store.BuyCoupon(ctx, "coupon-1", "client-1"); err == nil {
+		t.Errorf("expected an error when there are no coupons left")
+	}
+
+	coupon, err := store.GetCoupon(ctx, "coupon-1")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if coupon.AvailableCoupons != 0 {
+		t.Errorf("expected no coupons left, got %d", coupon.AvailableCoupons)
+	}
+
+	offers, err := store.GetUserOffers(ctx, "client-1", types.OfferQuery{Limit: 10})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(offers.Offers) != 2 {
+		t.Errorf("expected the 2 offers of the client, got %d", len(offers.Offers))
+	}
+}
+
+// only covers the lock of the memory store. The condition that keeps DynamoDB from overselling
+// is checked in TestPurchaseTransactionStockCondition
+func TestMemoryStoreBuyCouponDoesNotOversell(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	const stock = 10
+	const buyers = 50
+
+	enterprise := types.Enterprise{EnterpriseCode: "TEST"}
+	enterprise.Username = "enterprise-1"
+	store.RegisterEnterprise(ctx, enterprise)
+
+	store.PutCoupon(ctx, types.Coupon{
+		Id:               "coupon-1",
+		AvailableCoupons: stock,
+		CouponState:      types.CouponStateActive,
+		ValidUntil:       time.Now().Add(24 * time.Hour),
+		EnterpriseId:     "enterprise-1",
+	})
+
+	for i := 0; i < buyers; i++ {
+		client := types.Client{}
+		client.Username = fmt.Sprintf("client-%d", i)
+		store.RegisterClient(ctx, client)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		bought  int
+		soldOut int
+	)
+
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := store.BuyCoupon(ctx, "coupon-1", fmt.Sprintf("client-%d", i))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == nil:
+				bought++
+			case errors.Is(err, types.ErrSoldOut):
+				soldOut++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if bought != stock {
+		t.Errorf("expected %d purchases, got %d", stock, bought)
+	}
+
+	if soldOut != buyers-stock {
+		t.Errorf("expected %d sold out errors, got %d", buyers-stock, soldOut)
+	}
+
+	coupon, _ := store.GetCoupon(ctx, "coupon-1")
+
+	if coupon.AvailableCoupons != 0 {
+		t.Errorf("expected no coupons left, got %d", coupon.AvailableCoupons)
+	}
+
+	if coupon.SoldCoupons != stock {
+		t.Errorf("expected %d sold coupons, got %d", stock, coupon.SoldCoupons)
+	}
+}
+
+func TestMemoryStoreBuyUnlimitedCoupon(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	const buyers = 50
+
+	enterprise := types.Enterprise{EnterpriseCode: "TEST"}
+	enterprise.Username = "enterprise-1"
+	store.RegisterEnterprise(ctx, enterprise)
+
+	store.PutCoupon(ctx, types.Coupon{
+		Id:               "coupon-1",
+		AvailableCoupons: types.UnlimitedCoupons,
+		CouponState:      types.CouponStateActive,
+		ValidUntil:       time.Now().Add(24 * time.Hour),
+		EnterpriseId:     "enterprise-1",
+	})
+
+	for i := 0; i < buyers; i++ {
+		client := types.Client{}
+		client.Username = fmt.Sprintf("client-%d", i)
+		store.RegisterClient(ctx, client)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			if _, err := store.BuyCoupon(ctx, "coupon-1", fmt.Sprintf("client-%d", i)); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	coupon, _ := store.GetCoupon(ctx, "coupon-1")
+
+	if !coupon.IsUnlimited() {
+		t.Errorf("expected the coupon to stay unlimited, got %d available", coupon.AvailableCoupons)
+	}
+
+	if coupon.SoldCoupons != buyers {
+		t.Errorf("expected %d sold coupons, got %d", buyers, coupon.SoldCoupons)
+	}
+}
+
+func TestMemoryStoreBuyCouponSoldOut(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	enterprise := types.Enterprise{EnterpriseCode: "TEST"}
+	enterprise.Username = "enterprise-1"
+	store.RegisterEnterprise(ctx, enterprise)
+
+	client := types.Client{}
+	client.Username = "client-1"
+	store.RegisterClient(ctx, client)
+
+	store.PutCoupon(ctx, types.Coupon{
+		Id:               "coupon-1",
+		AvailableCoupons: 0,
+		SoldCoupons:      5,
+		CouponState:      types.CouponStateActive,
+		ValidUntil:       time.Now().Add(24 * time.Hour),
+		EnterpriseId:     "enterprise-1",
+	})
+
+	_, err := store.BuyCoupon(ctx, "coupon-1", "client-1")
+
+	if !errors.Is(err, types.ErrSoldOut) {
+		t.Errorf("expected a sold out error, got %v", err)
+	}
+}
+
+func TestMemoryStoreBuyCouponPurchaseLimit(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	const limit = 2
+
+	enterprise := types.Enterprise{EnterpriseCode: "TEST"}
+	enterprise.Username = "enterprise-1"
+	store.RegisterEnterprise(ctx, enterprise)
+
+	for _, username := range []string{"client-1", "client-2"} {
+		client := types.Client{}
+		client.Username = username
+		store.RegisterClient(ctx, client)
+	}
+
+	store.PutCoupon(ctx, types.Coupon{
+		Id:               "coupon-1",
+		AvailableCoupons: 10,
+		MaxPerClient:     limit,
+		CouponState:      types.CouponStateActive,
+		ValidUntil:       time.Now().Add(24 * time.Hour),
+		EnterpriseId:     "enterprise-1",
+	})
+
+	for i := 0; i < limit; i++ {
+		if _, err := store.BuyCoupon(ctx, "coupon-1", "client-1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	_, err := store.BuyCoupon(ctx, "coupon-1", "client-1")
+
+	if !errors.Is(err, types.ErrPurchaseLimit) {
+		t.Errorf("expected a purchase limit error, got %v", err)
+	}
+
+	// the limit is for each client
+	if _, err := store.BuyCoupon(ctx, "coupon-1", "client-2"); err != nil {
+		t.Errorf("unexpected error for another client: %v", err)
+	}
+
+	coupon, _ := store.GetCoupon(ctx, "coupon-1")
+
+	if coupon.SoldCoupons != limit+1 {
+		t.Errorf("expected %d sold coupons, got %d", limit+1, coupon.SoldCoupons)
+	}
+}
+
+func TestMemoryStoreUpdateClient(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	err := store.RegisterClient(ctx, types.Client{
+		User:      types.User{Username: "client-1", Email: "old@example.com"},
+		FirstName: "Ana",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	disabled := true
+	_, err = store.UpdateClient(ctx, "client-1", types.UserUpdate{Disabled: &disabled})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an update of the profile doesn't undo the one of the flag
+	firstName := "Beatriz"
+	client, err := store.UpdateClient(ctx, "client-1", types.UserUpdate{FirstName: &firstName})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !client.Disabled || client.FirstName != "Beatriz" || client.Email != "old@example.com" {
+		t.Errorf("expected only the first name to change, got %+v", client)
+	}
+
+	wrongEmail := "other@example.com"
+	_, err = store.UpdateClient(ctx, "client-1", types.UserUpdate{FirstName: &firstName, IfEmail: &wrongEmail})
+
+	if !errors.Is(err, types.ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+
+	_, err = store.UpdateClient(ctx, "missing", types.UserUpdate{FirstName: &firstName})
+
+	if !errors.Is(err, types.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
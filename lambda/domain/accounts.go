@@ -0,0 +1,263 @@
+package domain
+
+// Domain layer implementation for the account recovery and the email verification, through the emails with one-time tokens
+
+import (
+	"OriD19/webdev2/mail"
+	"OriD19/webdev2/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	defaultPasswordResetURL = "https://lacuponera.com/password/reset"
+
+	defaultEmailVerificationTTL = 48 * time.Hour
+	defaultEmailVerificationURL = "https://lacuponera.com/email/verify"
+)
+
+type Accounts struct {
+	tokens types.OneTimeTokenStore
+	mailer mail.Mailer
+}
+
+func NewAccountsDomain(s types.OneTimeTokenStore, mailer mail.Mailer) *Accounts {
+	return &Accounts{
+		tokens: s,
+		mailer: mailer,
+	}
+}
+
+// send a password reset link to the email of the client. Nothing tells the caller whether the account exists,
+// so this can't be used for finding out the usernames
+func (a *Accounts) ForgotPassword(ctx context.Context, body []byte, users *Users) error {
+	var forgotRequest types.ForgotPasswordRequest
+
+	err := json.Unmarshal(body, &forgotRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(forgotRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	client, err := users.store.GetClient(ctx, forgotRequest.Username)
+
+	if errors.Is(err, types.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// disabled accounts can't log in even with a new password
+	if client.Disabled {
+		return nil
+	}
+
+	token, err := newRandomToken()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ttl := durationFromEnv("PASSWORD_RESET_TTL", defaultPasswordResetTTL)
+
+	err = a.tokens.PutOneTimeToken(ctx, types.OneTimeToken{
+		Id:        hashToken(token),
+		Purpose:   types.PurposePasswordReset,
+		Username:  client.Username,
+		Role:      types.RoleClient,
+		Email:     client.Email,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	message, err := mail.PasswordResetMessage(client.Email, mail.PasswordResetData{
+		Name:      client.FirstName,
+		Link:      linkWithToken(os.Getenv("PASSWORD_RESET_URL"), defaultPasswordResetURL, token),
+		Token:     token,
+		ExpiresIn: int(ttl.Minutes()),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = a.mailer.Send(ctx, message)
+
+	// the token is useless without the email, but it expires by itself. The error is not returned,
+	// so the response is the same whether the account exists or not
+	if err != nil {
+		log.Printf("failed to send the password reset email to %s: %v", client.Username, err)
+	}
+
+	return nil
+}
+
+// change the password with the token of the email. Every session of the client is closed afterwards
+func (a *Accounts) ResetPassword(ctx context.Context, body []byte, users *Users, sessions *Sessions) error {
+	var resetRequest types.ResetPasswordRequest
+
+	err := json.Unmarshal(body, &resetRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(resetRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	token, err := a.tokens.ConsumeOneTimeToken(ctx, types.PurposePasswordReset, hashToken(resetRequest.Token))
+
+	if errors.Is(err, types.ErrNotFound) {
+		return fmt.Errorf("%w: invalid or expired reset token", types.ErrInvalidToken)
+	} else if err != nil {
+		return err
+	}
+
+	err = users.setClientPassword(ctx, token.Username, resetRequest.Password)
+
+	if err != nil {
+		return err
+	}
+
+	return sessions.LogoutAll(ctx, types.Principal{
+		Username: token.Username,
+		Role:     token.Role,
+	})
+}
+
+// send the verification link to the email of a client. The older links are still valid until they expire
+func (a *Accounts) SendEmailVerification(ctx context.Context, client *types.Client) error {
+	token, err := newRandomToken()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ttl := durationFromEnv("EMAIL_VERIFICATION_TTL", defaultEmailVerificationTTL)
+
+	// the table deletes the expired tokens with its TTL
+	err = a.tokens.PutOneTimeToken(ctx, types.OneTimeToken{
+		Id:        hashToken(token),
+		Purpose:   types.PurposeEmailVerification,
+		Username:  client.Username,
+		Role:      types.RoleClient,
+		Email:     client.Email,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	message, err := mail.EmailVerificationMessage(client.Email, mail.EmailVerificationData{
+		Name:      client.FirstName,
+		Link:      linkWithToken(os.Getenv("EMAIL_VERIFICATION_URL"), defaultEmailVerificationURL, token),
+		Token:     token,
+		ExpiresIn: int(ttl.Hours()),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, message)
+}
+
+// send the verification link again, for clients that didn't receive it or let it expire
+func (a *Accounts) ResendEmailVerification(ctx context.Context, username string, users *Users) error {
+	client, err := users.store.GetClient(ctx, username)
+
+	if err != nil {
+		return err
+	}
+
+	if client.IsEmailVerified() {
+		return fmt.Errorf("the email of %s is already verified: %w", username, types.ErrConflict)
+	}
+
+	return a.SendEmailVerification(ctx, &client)
+}
+
+// verify the email of a client with the token of the email
+func (a *Accounts) VerifyEmail(ctx context.Context, body []byte, users *Users) error {
+	var verifyRequest types.VerifyEmailRequest
+
+	err := json.Unmarshal(body, &verifyRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(verifyRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	token, err := a.tokens.ConsumeOneTimeToken(ctx, types.PurposeEmailVerification, hashToken(verifyRequest.Token))
+
+	if errors.Is(err, types.ErrNotFound) {
+		return fmt.Errorf("%w: invalid or expired verification token", types.ErrInvalidToken)
+	} else if err != nil {
+		return err
+	}
+
+	return users.setClientEmailVerified(ctx, token.Username, token.Email)
+}
+
+// the link of the frontend, with the token in the query string
+func linkWithToken(baseURL string, defaultURL string, token string) string {
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+
+	link, err := url.Parse(baseURL)
+
+	if err != nil {
+		link, _ = url.Parse(defaultURL)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+
+	if err != nil || duration <= 0 {
+		return defaultValue
+	}
+
+	return duration
+}
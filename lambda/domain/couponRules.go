@@ -0,0 +1,91 @@
+package domain
+
+// Business rules of the coupons, checked when they are created and updated
+
+import (
+	"OriD19/webdev2/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// the offer price must be at least this percentage lower than the regular price
+const minCouponDiscountPercent = 5
+
+func couponPriceErrors(regularPrice float32, offerPrice float32) types.ValidationErrors {
+	var fieldErrors types.ValidationErrors
+
+	if regularPrice <= 0 {
+		return append(fieldErrors, types.FieldError{Field: "regularPrice", Message: "must be greater than zero"})
+	}
+
+	if offerPrice >= regularPrice {
+		return append(fieldErrors, types.FieldError{Field: "offerPrice", Message: "must be lower than the regular price"})
+	}
+
+	discount := (1 - offerPrice/regularPrice) * 100
+
+	if discount < minCouponDiscountPercent {
+		fieldErrors = append(fieldErrors, types.FieldError{
+			Field:   "offerPrice",
+			Message: fmt.Sprintf("must be at least %d%% lower than the regular price", minCouponDiscountPercent),
+		})
+	}
+
+	return fieldErrors
+}
+
+func couponDateErrors(validFrom time.Time, validUntil time.Time, now time.Time) types.ValidationErrors {
+	var fieldErrors types.ValidationErrors
+
+	if !validUntil.After(now) {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "expiresAt", Message: "must be in the future"})
+	}
+
+	if !validFrom.Before(validUntil) {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "validFrom", Message: "must be before the expiration date"})
+	}
+
+	return fieldErrors
+}
+
+// nil when there are no errors, so it can be returned directly
+func validationError(fieldErrors types.ValidationErrors) error {
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	return fieldErrors
+}
+
+// the errors of the validate tags of a request, with the names of the JSON fields
+func requestValidationError(err error) error {
+	var tagErrors validator.ValidationErrors
+
+	if !errors.As(err, &tagErrors) {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	fieldErrors := make(types.ValidationErrors, 0, len(tagErrors))
+
+	for _, tagError := range tagErrors {
+		message := "failed on the '" + tagError.Tag() + "' rule"
+
+		if tagError.Param() != "" {
+			message = "failed on the '" + tagError.Tag() + "=" + tagError.Param() + "' rule"
+		}
+
+		// the JSON names are the field names in lower camel case
+		field := tagError.Field()
+
+		fieldErrors = append(fieldErrors, types.FieldError{
+			Field:   strings.ToLower(field[:1]) + field[1:],
+			Message: message,
+		})
+	}
+
+	return fieldErrors
+}
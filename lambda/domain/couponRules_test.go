@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"OriD19/webdev2/types"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestCouponPriceErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		regularPrice float32
+		offerPrice   float32
+		want         types.ValidationErrors
+	}{
+		{"valid discount", 100, 50, nil},
+		{"exactly 5% discount", 100, 95, nil},
+		{"exactly 5% discount with cents", 19.99, 18.99, nil},
+		{"less than 5% discount", 100, 95.01, types.ValidationErrors{
+			{Field: "offerPrice", Message: "must be at least 5% lower than the regular price"},
+		}},
+		{"offer price equal to the regular price", 100, 100, types.ValidationErrors{
+			{Field: "offerPrice", Message: "must be lower than the regular price"},
+		}},
+		{"offer price over the regular price", 100, 120, types.ValidationErrors{
+			{Field: "offerPrice", Message: "must be lower than the regular price"},
+		}},
+		{"free offer", 100, 0, nil},
+		{"zero regular price", 0, 0, types.ValidationErrors{
+			{Field: "regularPrice", Message: "must be greater than zero"},
+		}},
+		{"negative regular price", -10, -20, types.ValidationErrors{
+			{Field: "regularPrice", Message: "must be greater than zero"},
+		}},
+	}
+
+	for _, test := range tests {
+		got := couponPriceErrors(test.regularPrice, test.offerPrice)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestCouponDateErrors(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		validFrom  time.Time
+		validUntil time.Time
+		want       types.ValidationErrors
+	}{
+		{"valid dates", now, now.Add(24 * time.Hour), nil},
+		{"equal dates", now.Add(time.Hour), now.Add(time.Hour), types.ValidationErrors{
+			{Field: "validFrom", Message: "must be before the expiration date"},
+		}},
+		{"starts after the expiration", now.Add(48 * time.Hour), now.Add(24 * time.Hour), types.ValidationErrors{
+			{Field: "validFrom", Message: "must be before the expiration date"},
+		}},
+		{"expires now", now.Add(-time.Hour), now, types.ValidationErrors{
+			{Field: "expiresAt", Message: "must be in the future"},
+		}},
+		{"expired and starts after the expiration", now, now.Add(-time.Hour), types.ValidationErrors{
+			{Field: "expiresAt", Message: "must be in the future"},
+			{Field: "validFrom", Message: "must be before the expiration date"},
+		}},
+	}
+
+	for _, test := range tests {
+		got := couponDateErrors(test.validFrom, test.validUntil, now)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	if err := validationError(nil); err != nil {
+		t.Errorf("expected nil without field errors, got %v", err)
+	}
+
+	err := validationError(types.ValidationErrors{{Field: "offerPrice", Message: "must be lower than the regular price"}})
+
+	if !errors.Is(err, types.ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+}
+
+func TestRequestValidationError(t *testing.T) {
+	type request struct {
+		Title            string `validate:"required"`
+		AvailableCoupons int    `validate:"gte=-1"`
+	}
+
+	err := requestValidationError(validator.New().Struct(request{AvailableCoupons: -2}))
+
+	want := types.ValidationErrors{
+		{Field: "title", Message: "failed on the 'required' rule"},
+		{Field: "availableCoupons", Message: "failed on the 'gte=-1' rule"},
+	}
+
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
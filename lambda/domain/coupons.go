@@ -6,8 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand/v2"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -15,30 +16,45 @@ import (
 )
 
 var (
-	ErrJsonUnmarshal     = errors.New("failed to parse product from request body")
-	ErrProductIdMismatch = errors.New("product ID in path does not match product ID in body")
+	ErrJsonUnmarshal      = errors.New("failed to parse product from request body")
+	ErrProductIdMismatch  = errors.New("product ID in path does not match product ID in body")
+	ErrInvalidOfferStatus = errors.New("offer status must be one of: active, redeemed, expired")
+)
+
+// transitions allowed for each state of a coupon. Rejected and expired coupons can't change anymore
+var couponTransitions = map[string][]string{
+	types.CouponStatePending:  {types.CouponStateActive, types.CouponStateRejected},
+	types.CouponStateActive:   {types.CouponStateInactive, types.CouponStateExpired},
+	types.CouponStateInactive: {types.CouponStateActive, types.CouponStateExpired},
+}
+
+// page sizes for the list endpoints
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 50
 )
 
 // implementation of the Coupons store for CRUD operations over coupons
 
 type Coupons struct {
-	store types.CouponStore
+	store  types.CouponStore
+	search types.SearchIndex
+
+	// when the search index was last loaded from the store
+	searchMu       sync.Mutex
+	searchLoadedAt time.Time
 }
 
-func NewCouponsDomain(s types.CouponStore) *Coupons {
+func NewCouponsDomain(s types.CouponStore, search types.SearchIndex) *Coupons {
 	return &Coupons{
-		store: s,
+		store:  s,
+		search: search,
 	}
 }
 
-func (c *Coupons) GetAllCoupons(ctx context.Context, next *string) (types.CouponRange, error) {
+func (c *Coupons) GetAllCoupons(ctx context.Context, next *string, limit int) (types.CouponRange, error) {
 
-	// check if next is just empty spaces
-	if next != nil && strings.TrimSpace(*next) == "" {
-		next = nil
-	}
-
-	couponRange, err := c.store.GetAllCoupons(ctx, next)
+	couponRange, err := c.store.GetAllCoupons(ctx, normalizeNextToken(next), pageSize(limit))
 
 	if err != nil {
 		return types.CouponRange{}, err
@@ -47,8 +63,8 @@ func (c *Coupons) GetAllCoupons(ctx context.Context, next *string) (types.Coupon
 	return couponRange, nil
 }
 
-func (c *Coupons) GetAllCouponsFromCategory(ctx context.Context, category string) (types.CouponRange, error) {
-	couponRange, err := c.store.GetAllCouponsFromCategory(ctx, category)
+func (c *Coupons) GetAllCouponsFromCategory(ctx context.Context, category string, next *string, limit int) (types.CouponRange, error) {
+	couponRange, err := c.store.GetAllCouponsFromCategory(ctx, category, normalizeNextToken(next), pageSize(limit))
 
 	if err != nil {
 		return types.CouponRange{}, err
@@ -57,6 +73,24 @@ func (c *Coupons) GetAllCouponsFromCategory(ctx context.Context, category string
 	return couponRange, nil
 }
 
+// check if next is just empty spaces
+func normalizeNextToken(next *string) *string {
+	if next != nil && strings.TrimSpace(*next) == "" {
+		return nil
+	}
+
+	return next
+}
+
+// use the default page size when no limit is given, and never go above the maximum
+func pageSize(limit int) int32 {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+
+	return int32(min(limit, MaxPageSize))
+}
+
 func (c *Coupons) GetCoupon(ctx context.Context, id string) (*types.Coupon, error) {
 	coupon, err := c.store.GetCoupon(ctx, id)
 
@@ -64,10 +98,105 @@ func (c *Coupons) GetCoupon(ctx context.Context, id string) (*types.Coupon, erro
 		return &types.Coupon{}, err
 	}
 
+	// coupons are expired the first time they are read after their validity date
+	if isPastValidity(coupon, time.Now()) {
+		expired, err := c.changeCouponState(ctx, coupon, types.CouponStateExpired, types.SystemActor, "")
+
+		// someone else changed the state first, keep the coupon as it was read
+		if errors.Is(err, types.ErrInvalidState) {
+			return &coupon, nil
+		} else if err != nil {
+			return &types.Coupon{}, err
+		}
+
+		return expired, nil
+	}
+
 	return &coupon, nil
 }
 
-func (c *Coupons) PutCoupon(ctx context.Context, id *string, body []byte, userDomain *Users) (*types.Coupon, error) {
+// the coupon can still expire, but its date already passed
+func isPastValidity(coupon types.Coupon, now time.Time) bool {
+	return slices.Contains(couponTransitions[coupon.CouponState], types.CouponStateExpired) && !coupon.ValidUntil.After(now)
+}
+
+// the lists show the coupons past their date as expired, without saving them one by one.
+// They are saved the next time they are read with GetCoupon
+func withExpiredStates(couponRange types.CouponRange) types.CouponRange {
+	now := time.Now()
+
+	for i, coupon := range couponRange.Coupons {
+		if isPastValidity(coupon, now) {
+			couponRange.Coupons[i].CouponState = types.CouponStateExpired
+		}
+	}
+
+	return couponRange
+}
+
+// make the coupon available to the clients
+func (c *Coupons) ApproveCoupon(ctx context.Context, id string, administrator string) (*types.Coupon, error) {
+	coupon, err := c.GetCoupon(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.changeCouponState(ctx, *coupon, types.CouponStateActive, administrator, "")
+}
+
+// reject a pending coupon. The reason is shown to the enterprise
+func (c *Coupons) RejectCoupon(ctx context.Context, id string, body []byte, administrator string) (*types.Coupon, error) {
+	rejectRequest := types.RejectCouponRequest{}
+
+	if err := json.Unmarshal(body, &rejectRequest); err != nil {
+		return nil, fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err := validate.Struct(rejectRequest)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	coupon, err := c.GetCoupon(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.changeCouponState(ctx, *coupon, types.CouponStateRejected, administrator, strings.TrimSpace(rejectRequest.Reason))
+}
+
+// check that the transition is allowed, and save it
+func (c *Coupons) changeCouponState(ctx context.Context, coupon types.Coupon, to string, by string, reason string) (*types.Coupon, error) {
+	if !slices.Contains(couponTransitions[coupon.CouponState], to) {
+		return nil, fmt.Errorf("a %s coupon can't be changed to %s: %w", coupon.CouponState, to, types.ErrInvalidState)
+	}
+
+	transition := types.CouponTransition{
+		From:   coupon.CouponState,
+		To:     to,
+		By:     by,
+		At:     time.Now().UTC(),
+		Reason: reason,
+	}
+
+	updated, err := c.store.UpdateCouponState(ctx, coupon.Id, transition)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.indexCoupon(ctx, updated)
+
+	return &updated, nil
+}
+
+// the coupon is created for the given enterprise. An empty enterpriseId means the caller is an administrator,
+// so the enterprise is taken from the request body instead
+func (c *Coupons) PutCoupon(ctx context.Context, body []byte, enterpriseId string, createdBy string, userDomain *Users) (*types.Coupon, error) {
 	couponRequest := types.CreateNewCouponRequest{}
 
 	if err := json.Unmarshal(body, &couponRequest); err != nil {
@@ -78,9 +207,10 @@ func (c *Coupons) PutCoupon(ctx context.Context, id *string, body []byte, userDo
 	err := validate.Struct(couponRequest)
 
 	if err != nil {
-		return nil, fmt.Errorf("%w", err)
+		return nil, requestValidationError(err)
 	}
 
+	now := time.Now().UTC()
 	coupon := types.Coupon{}
 
 	// populate the newly created coupon object
@@ -89,26 +219,63 @@ func (c *Coupons) PutCoupon(ctx context.Context, id *string, body []byte, userDo
 	coupon.RegularPrice = couponRequest.RegularPrice
 	coupon.OfferPrice = couponRequest.OfferPrice
 	coupon.AvailableCoupons = couponRequest.AvailableCoupons
-	coupon.ValidFrom = time.Now()
-	coupon.ValidUntil = couponRequest.ExpiresAt.Time
+	coupon.CreatedAt = now
+	coupon.ValidFrom = now
+	// dates are compared as strings inside DynamoDB, so all of them are saved in UTC
+	coupon.ValidUntil = couponRequest.ExpiresAt.Time.UTC()
 	coupon.OfferDesc = couponRequest.OfferDesc
+	coupon.MaxPerClient = couponRequest.MaxPerClient
+
+	var fieldErrors types.ValidationErrors
+
+	// scheduled launch. The dates have no time, so today is accepted and starts right away
+	if couponRequest.ValidFrom != nil {
+		validFrom := couponRequest.ValidFrom.Time.UTC()
+
+		if validFrom.Before(now.Truncate(24 * time.Hour)) {
+			fieldErrors = append(fieldErrors, types.FieldError{Field: "validFrom", Message: "can't be in the past"})
+		} else if validFrom.After(now) {
+			coupon.ValidFrom = validFrom
+		}
+	}
+
+	fieldErrors = append(fieldErrors, couponPriceErrors(coupon.RegularPrice, coupon.OfferPrice)...)
+	fieldErrors = append(fieldErrors, couponDateErrors(coupon.ValidFrom, coupon.ValidUntil, now)...)
+
+	if err := validationError(fieldErrors); err != nil {
+		return nil, err
+	}
+
+	if enterpriseId == "" {
+		enterpriseId = couponRequest.EnterpriseId
+	}
+
+	if enterpriseId == "" {
+		return nil, fmt.Errorf("%w: enterpriseId is required", types.ErrValidation)
+	}
+
+	enterprise, err := userDomain.GetActiveEnterprise(ctx, enterpriseId)
 
-	// !IMPORTANT: ONLY FOR THE FIRST PART OF THE PROJECT, SELECT A RANDOM ENTERPRISE FROM AN ALREADY DEFINED ARRAY
-	randIndex := rand.IntN(5)
-	coupon.EnterpriseId = EnterprisesIds[randIndex]
-	enterprise, err := userDomain.GetEnterprise(ctx, EnterprisesIds[randIndex])
 	if err != nil {
-		return nil, fmt.Errorf("provided enterprise not found")
+		return nil, fmt.Errorf("provided enterprise not available: %w", err)
 	}
+
+	coupon.EnterpriseId = enterprise.Username
 	coupon.Category = enterprise.Category
 
-	if id != nil {
-		coupon.Id = *id
-	} else {
-		// assign new UUID to the coupon
-		coupon.Id = uuid.New().String()
+	// new coupons must be approved by an administrator before the clients can see them
+	coupon.CouponState = types.CouponStatePending
+	coupon.StateHistory = []types.CouponTransition{
+		{
+			To: types.CouponStatePending,
+			By: createdBy,
+			At: now,
+		},
 	}
 
+	// assign new UUID to the coupon. Existing coupons are edited with UpdateCoupon
+	coupon.Id = uuid.New().String()
+
 	err = c.store.PutCoupon(ctx, coupon)
 
 	if err != nil {
@@ -118,8 +285,89 @@ func (c *Coupons) PutCoupon(ctx context.Context, id *string, body []byte, userDo
 	return &coupon, nil
 }
 
-func (c *Coupons) RedeemCoupon(ctx context.Context, id string) error {
-	err := c.store.RedeemCoupon(ctx, id)
+// partial update of a coupon. An empty enterpriseId means the caller is an administrator,
+// otherwise the coupon must belong to that enterprise
+func (c *Coupons) UpdateCoupon(ctx context.Context, id string, body []byte, enterpriseId string) (*types.Coupon, error) {
+	var updateRequest types.UpdateCouponRequest
+
+	if err := json.Unmarshal(body, &updateRequest); err != nil {
+		return nil, fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err := validate.Struct(updateRequest)
+
+	if err != nil {
+		return nil, requestValidationError(err)
+	}
+
+	// read through the domain, so the coupons past their date are expired first
+	coupon, err := c.GetCoupon(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the coupons of other enterprises are not found, like in RemoveEmployee
+	if enterpriseId != "" && coupon.EnterpriseId != enterpriseId {
+		return nil, fmt.Errorf("coupon %w", types.ErrNotFound)
+	}
+
+	switch coupon.CouponState {
+	case types.CouponStateExpired, types.CouponStateRejected:
+		return nil, fmt.Errorf("%s coupons can't be edited: %w", coupon.CouponState, types.ErrInvalidState)
+	}
+
+	update := types.CouponUpdate{
+		Title:        updateRequest.Title,
+		RegularPrice: updateRequest.RegularPrice,
+		OfferPrice:   updateRequest.OfferPrice,
+		OfferDesc:    updateRequest.OfferDesc,
+		MaxPerClient: updateRequest.MaxPerClient,
+	}
+
+	if updateRequest.ExpiresAt != nil {
+		validUntil := updateRequest.ExpiresAt.Time.UTC()
+		update.ValidUntil = &validUntil
+	}
+
+	// check the prices and the dates as they will be after the update. Only the rules of the changed
+	// fields are checked, so the coupons created before the rules can still be edited
+	var fieldErrors types.ValidationErrors
+
+	if update.RegularPrice != nil || update.OfferPrice != nil {
+		if update.RegularPrice != nil {
+			coupon.RegularPrice = *update.RegularPrice
+		}
+
+		if update.OfferPrice != nil {
+			coupon.OfferPrice = *update.OfferPrice
+		}
+
+		fieldErrors = append(fieldErrors, couponPriceErrors(coupon.RegularPrice, coupon.OfferPrice)...)
+	}
+
+	if update.ValidUntil != nil {
+		fieldErrors = append(fieldErrors, couponDateErrors(coupon.ValidFrom, *update.ValidUntil, time.Now())...)
+	}
+
+	if err := validationError(fieldErrors); err != nil {
+		return nil, err
+	}
+
+	updated, err := c.store.UpdateCoupon(ctx, id, update)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.indexCoupon(ctx, updated)
+
+	return &updated, nil
+}
+
+func (c *Coupons) RedeemCoupon(ctx context.Context, id string, employee types.Employee) error {
+	err := c.store.RedeemCoupon(ctx, id, employee)
 
 	if err != nil {
 		return err
@@ -138,8 +386,39 @@ func (c *Coupons) BuyCoupon(ctx context.Context, couponId string, userId string)
 	return &generatedOffer, nil
 }
 
-func (c *Coupons) GetUserOffers(ctx context.Context, id string) (types.OfferRange, error) {
-	offerRange, err := c.store.GetUserOffers(ctx, id)
+func (c *Coupons) GetUserOffers(ctx context.Context, id string, query types.OfferQuery) (types.OfferRange, error) {
+	switch query.Status {
+	case "", types.OfferStatusActive, types.OfferStatusRedeemed, types.OfferStatusExpired:
+	default:
+		return types.OfferRange{}, ErrInvalidOfferStatus
+	}
+
+	query.Next = normalizeNextToken(query.Next)
+	query.Limit = pageSize(int(query.Limit))
+
+	offerRange, err := c.store.GetUserOffers(ctx, id, query)
+
+	if err != nil {
+		return types.OfferRange{}, err
+	}
+
+	return offerRange, nil
+}
+
+// coupons of an enterprise in any state, for its portal
+func (c *Coupons) GetEnterpriseCoupons(ctx context.Context, enterpriseId string, next *string, limit int) (types.CouponRange, error) {
+	couponRange, err := c.store.GetEnterpriseCoupons(ctx, enterpriseId, normalizeNextToken(next), pageSize(limit))
+
+	if err != nil {
+		return types.CouponRange{}, err
+	}
+
+	return withExpiredStates(couponRange), nil
+}
+
+// offers sold by an enterprise
+func (c *Coupons) GetEnterpriseSales(ctx context.Context, enterpriseId string, next *string, limit int) (types.OfferRange, error) {
+	offerRange, err := c.store.GetEnterpriseOffers(ctx, enterpriseId, normalizeNextToken(next), pageSize(limit))
 
 	if err != nil {
 		return types.OfferRange{}, err
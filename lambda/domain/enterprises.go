@@ -0,0 +1,240 @@
+package domain
+
+// Domain layer for the enterprises, managed by the administrators
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// how many random codes are tried before giving up
+const enterpriseCodeAttempts = 5
+
+func (u *Users) RegisterEnterprise(ctx context.Context, body []byte) (*types.Enterprise, error) {
+	var enterpriseRequest types.RegisterEnterpriseRequest
+
+	err := json.Unmarshal(body, &enterpriseRequest)
+
+	if err != nil {
+		return &types.Enterprise{}, fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(enterpriseRequest)
+
+	if err != nil {
+		return &types.Enterprise{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	// the username is also the id of the enterprise
+	_, err = u.store.GetEnterprise(ctx, enterpriseRequest.Username)
+
+	if err == nil {
+		return &types.Enterprise{}, fmt.Errorf("username %s is already taken: %w", enterpriseRequest.Username, types.ErrConflict)
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return &types.Enterprise{}, err
+	}
+
+	code, err := u.reserveEnterpriseCode(ctx, enterpriseRequest.EnterpriseName, enterpriseRequest.Username)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	// hash password before storing the user
+	hashedPassword, err := types.HashPassword(enterpriseRequest.Password)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	enterprise := types.Enterprise{}
+	enterprise.EntityType = "enterprise"
+	enterprise.Username = enterpriseRequest.Username
+	enterprise.Email = enterpriseRequest.Email
+	enterprise.Password = hashedPassword
+	enterprise.CreatedAt = time.Now()
+	enterprise.EnterpriseCode = code
+	enterprise.EnterpriseName = enterpriseRequest.EnterpriseName
+	enterprise.ScheduleDescription = enterpriseRequest.ScheduleDescription
+	enterprise.Location = enterpriseRequest.Location
+	enterprise.PhoneNumber = enterpriseRequest.PhoneNumber
+	enterprise.Category = enterpriseRequest.Category
+
+	err = u.store.RegisterEnterprise(ctx, enterprise)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	return &enterprise, nil
+}
+
+// the codes are the prefix of the generated offers: three letters of the name and three digits (for example, ATO123)
+func (u *Users) reserveEnterpriseCode(ctx context.Context, name string, enterpriseId string) (string, error) {
+	prefix := []rune{}
+
+	for _, r := range strings.ToUpper(name) {
+		if r <= unicode.MaxASCII && unicode.IsLetter(r) {
+			prefix = append(prefix, r)
+		}
+
+		if len(prefix) == 3 {
+			break
+		}
+	}
+
+	for len(prefix) < 3 {
+		prefix = append(prefix, 'X')
+	}
+
+	for range enterpriseCodeAttempts {
+		code := fmt.Sprintf("%s%03d", string(prefix), rand.IntN(1000))
+
+		err := u.store.ReserveEnterpriseCode(ctx, code, enterpriseId)
+
+		if errors.Is(err, types.ErrConflict) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		return code, nil
+	}
+
+	return "", fmt.Errorf("failed to generate a unique enterprise code: %w", types.ErrConflict)
+}
+
+// the enterprise code can't be changed, because it is part of the offers already sold
+func (u *Users) UpdateEnterprise(ctx context.Context, id string, body []byte) (*types.Enterprise, error) {
+	var updateRequest types.UpdateEnterpriseRequest
+
+	err := json.Unmarshal(body, &updateRequest)
+
+	if err != nil {
+		return &types.Enterprise{}, fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(updateRequest)
+
+	if err != nil {
+		return &types.Enterprise{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	enterprise, err := u.store.GetEnterprise(ctx, id)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	if updateRequest.Email != nil {
+		enterprise.Email = *updateRequest.Email
+	}
+	if updateRequest.EnterpriseName != nil {
+		enterprise.EnterpriseName = *updateRequest.EnterpriseName
+	}
+	if updateRequest.ScheduleDescription != nil {
+		enterprise.ScheduleDescription = *updateRequest.ScheduleDescription
+	}
+	if updateRequest.Location != nil {
+		enterprise.Location = *updateRequest.Location
+	}
+	if updateRequest.PhoneNumber != nil {
+		enterprise.PhoneNumber = *updateRequest.PhoneNumber
+	}
+	// the coupons already published keep their category
+	if updateRequest.Category != nil {
+		enterprise.Category = *updateRequest.Category
+	}
+
+	err = u.store.RegisterEnterprise(ctx, enterprise)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	return &enterprise, nil
+}
+
+// enterprises are never deleted, because their coupons and offers still reference them
+func (u *Users) DeactivateEnterprise(ctx context.Context, id string) (*types.Enterprise, error) {
+	enterprise, err := u.store.GetEnterprise(ctx, id)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	if enterprise.Deactivated {
+		return &types.Enterprise{}, fmt.Errorf("enterprise is already deactivated: %w", types.ErrInvalidState)
+	}
+
+	enterprise.Deactivated = true
+
+	err = u.store.RegisterEnterprise(ctx, enterprise)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	return &enterprise, nil
+}
+
+func (u *Users) ListEnterprises(ctx context.Context, next *string, limit int) (types.EnterpriseRange, error) {
+	enterpriseRange, err := u.store.ListEnterprises(ctx, normalizeNextToken(next), pageSize(limit))
+
+	if err != nil {
+		return types.EnterpriseRange{}, err
+	}
+
+	return enterpriseRange, nil
+}
+
+// same as GetEnterprise, but fails if the enterprise was deactivated
+func (u *Users) GetActiveEnterprise(ctx context.Context, id string) (*types.Enterprise, error) {
+	enterprise, err := u.GetEnterprise(ctx, id)
+
+	if err != nil {
+		return &types.Enterprise{}, err
+	}
+
+	if enterprise.Deactivated {
+		return &types.Enterprise{}, fmt.Errorf("enterprise %s is deactivated: %w", id, types.ErrInvalidState)
+	}
+
+	return enterprise, nil
+}
+
+func (u *Users) GetEnterpriseEmployees(ctx context.Context, enterpriseId string, next *string, limit int) (types.EmployeeRange, error) {
+	employees, err := u.store.GetEnterpriseEmployees(ctx, enterpriseId, normalizeNextToken(next), pageSize(limit))
+
+	if err != nil {
+		return types.EmployeeRange{}, err
+	}
+
+	return employees, nil
+}
+
+// an enterprise can only remove its own employees. The employees of other enterprises are reported as not found
+func (u *Users) RemoveEmployee(ctx context.Context, enterpriseId string, employeeId string) error {
+	employee, err := u.store.GetEmployee(ctx, employeeId)
+
+	if err != nil {
+		return err
+	}
+
+	if employee.EnterpriseId != enterpriseId {
+		return fmt.Errorf("employee %w", types.ErrNotFound)
+	}
+
+	return u.store.DeleteEmployee(ctx, employeeId)
+}
@@ -1,9 +0,0 @@
-package domain
-
-/*
-!IMPORTANT: THESE IS FOR THE FIRST PART OF THE PROJECT ONLY
-Enterprises are defined manually inside the database, and the mechanism (to avoid making the whole system at once)
-will be to define the Enterprises IDs inside this array, and pick them randomly. So, who cares.
-The contents of the coupons will not be that coherent, but is the most efficient way to test everything
-*/
-var EnterprisesIds = [5]string{"ATONIOSFOODS", "BELLEZASALON", "MARCOSRESTAURANTES", "CASASPA", "ALMACENESCORAZON"}
@@ -0,0 +1,157 @@
+package domain
+
+// Domain layer implementation for the brute-force protection of the login endpoints
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// failures before the first lockout. An IP address is shared by many users (offices, mobile networks...),
+	// so it gets more attempts than a single account
+	userLoginThreshold = 5
+	ipLoginThreshold   = 20
+
+	// the lockout doubles with every failure after the threshold: 1m, 2m, 4m... up to an hour
+	baseLoginLockout = time.Minute
+	maxLoginLockout  = time.Hour
+
+	// the counters start again after a day without failures
+	loginAttemptsWindow = 24 * time.Hour
+)
+
+type Logins struct {
+	store types.LoginAttemptStore
+	now   func() time.Time
+}
+
+func NewLoginsDomain(s types.LoginAttemptStore) *Logins {
+	return &Logins{
+		store: s,
+		now:   time.Now,
+	}
+}
+
+// the counters of a login in progress, see Logins.Attempt
+type LoginAttempt struct {
+	userKey string
+	ipKey   string
+}
+
+// counts the login for the user and for the IP address before the password is checked, so the parallel guesses
+// can't get past the threshold. A positive duration means the login is locked for that long, and the password
+// must not be checked. The username is counted even if it doesn't exist, so the lockout doesn't tell which
+// usernames are taken
+func (l *Logins) Attempt(ctx context.Context, role string, username string, sourceIP string) (LoginAttempt, time.Duration, error) {
+	now := l.now()
+	attempt := LoginAttempt{
+		userKey: userLoginKey(role, username),
+		ipKey:   ipLoginKey(sourceIP),
+	}
+
+	ipLock, err := l.attempt(ctx, attempt.ipKey, ipLoginThreshold, now)
+
+	if err != nil || ipLock > 0 {
+		return attempt, ipLock, err
+	}
+
+	userLock, err := l.attempt(ctx, attempt.userKey, userLoginThreshold, now)
+
+	if err != nil || userLock > 0 {
+		// the password of this login is never checked, so it doesn't count for the IP address
+		if releaseErr := l.store.ReleaseLoginAttempt(ctx, attempt.ipKey); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+
+		return attempt, userLock, err
+	}
+
+	return attempt, 0, nil
+}
+
+// the lockout is decided from the count returned by the store, so every concurrent attempt gets a different answer
+func (l *Logins) attempt(ctx context.Context, key string, threshold int, now time.Time) (time.Duration, error) {
+	attempts, err := l.store.RecordLoginAttempt(ctx, key, now, now.Add(loginAttemptsWindow))
+
+	if errors.Is(err, types.ErrLoginLocked) {
+		return max(time.Unix(attempts.LockedUntil, 0).Sub(now), time.Second), nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case attempts.Failures < threshold:
+		return 0, nil
+	// the attempt that reaches the threshold, or the first one after a lockout: it goes on, and the login
+	// is locked for the next ones
+	case attempts.LockedFailures == 0 && attempts.Failures == threshold,
+		attempts.LockedFailures > 0 && attempts.Failures == attempts.LockedFailures+1:
+		lockout := loginLockout(attempts.Failures, threshold)
+
+		return 0, l.store.LockLogin(ctx, key, attempts.Failures, now.Add(lockout))
+	// counted at the same time as the attempt that locks the login
+	default:
+		return loginLockout(attempts.Failures, threshold), nil
+	}
+}
+
+// a successful login clears the failures of the user, and takes its attempt back from the IP address
+func (l *Logins) Succeeded(ctx context.Context, attempt LoginAttempt) error {
+	err := l.store.ClearLoginAttempts(ctx, attempt.userKey)
+
+	if err != nil {
+		return err
+	}
+
+	return l.store.ReleaseLoginAttempt(ctx, attempt.ipKey)
+}
+
+// used by the administrators for unlocking an account before its lockout ends
+func (l *Logins) Unlock(ctx context.Context, username string, body []byte) error {
+	var unlockRequest types.UnlockUserRequest
+
+	err := json.Unmarshal(body, &unlockRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(unlockRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	return l.store.ClearLoginAttempts(ctx, userLoginKey(unlockRequest.UserType, username))
+}
+
+func loginLockout(failures int, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	lockout := baseLoginLockout
+
+	for i := threshold; i < failures && lockout < maxLoginLockout; i++ {
+		lockout *= 2
+	}
+
+	return min(lockout, maxLoginLockout)
+}
+
+// the usernames are only unique for each role
+func userLoginKey(role string, username string) string {
+	return "user#" + role + "#" + username
+}
+
+func ipLoginKey(sourceIP string) string {
+	return "ip#" + sourceIP
+}
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/types"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logins over the memory store, with a clock that the tests move
+func newTestLogins() (*Logins, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	logins := NewLoginsDomain(database.NewMemoryStore())
+	logins.now = func() time.Time { return now }
+
+	return logins, &now
+}
+
+func attemptLogin(t *testing.T, logins *Logins, username string, sourceIP string) (LoginAttempt, time.Duration) {
+	t.Helper()
+
+	attempt, lockedFor, err := logins.Attempt(context.Background(), types.RoleClient, username, sourceIP)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return attempt, lockedFor
+}
+
+func TestLoginsLockoutThreshold(t *testing.T) {
+	logins, now := newTestLogins()
+
+	for i := 1; i <= userLoginThreshold; i++ {
+		if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != 0 {
+			t.Fatalf("attempt %d: expected no lockout, got %v", i, lockedFor)
+		}
+	}
+
+	if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != baseLoginLockout {
+		t.Fatalf("expected a lockout of %v after the threshold, got %v", baseLoginLockout, lockedFor)
+	}
+
+	// the other users are not locked
+	if _, lockedFor := attemptLogin(t, logins, "client-2", "10.0.0.1"); lockedFor != 0 {
+		t.Fatalf("expected no lockout for another user, got %v", lockedFor)
+	}
+
+	// one more attempt after the lockout, and the next lockout is twice as long
+	*now = now.Add(baseLoginLockout)
+
+	if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != 0 {
+		t.Fatalf("expected an attempt after the lockout, got a lockout of %v", lockedFor)
+	}
+
+	if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != 2*baseLoginLockout {
+		t.Fatalf("expected a lockout of %v, got %v", 2*baseLoginLockout, lockedFor)
+	}
+}
+
+func TestLoginsLockoutWindowExpiry(t *testing.T) {
+	logins, now := newTestLogins()
+
+	for i := 0; i <= userLoginThreshold; i++ {
+		attemptLogin(t, logins, "client-1", "10.0.0.1")
+	}
+
+	// a day without attempts starts the counter again
+	*now = now.Add(loginAttemptsWindow + time.Second)
+
+	for i := 1; i <= userLoginThreshold; i++ {
+		if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != 0 {
+			t.Fatalf("attempt %d: expected no lockout after the window, got %v", i, lockedFor)
+		}
+	}
+
+	if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != baseLoginLockout {
+		t.Fatalf("expected a lockout of %v, got %v", baseLoginLockout, lockedFor)
+	}
+}
+
+func TestLoginsSucceededResetsFailures(t *testing.T) {
+	logins, _ := newTestLogins()
+
+	for i := 1; i < userLoginThreshold; i++ {
+		attemptLogin(t, logins, "client-1", "10.0.0.1")
+	}
+
+	attempt, _ := attemptLogin(t, logins, "client-1", "10.0.0.1")
+
+	if err := logins.Succeeded(context.Background(), attempt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 1; i <= userLoginThreshold; i++ {
+		if _, lockedFor := attemptLogin(t, logins, "client-1", "10.0.0.1"); lockedFor != 0 {
+			t.Fatalf("attempt %d: expected no lockout after a successful login, got %v", i, lockedFor)
+		}
+	}
+}
+
+func TestLoginsSuccessfulLoginsDontLockTheIP(t *testing.T) {
+	logins, _ := newTestLogins()
+
+	// an office, with many users behind the same address
+	for i := 0; i < 2*ipLoginThreshold; i++ {
+		attempt, lockedFor := attemptLogin(t, logins, fmt.Sprintf("client-%d", i), "10.0.0.1")
+
+		if lockedFor != 0 {
+			t.Fatalf("login %d: expected no lockout, got %v", i, lockedFor)
+		}
+
+		if err := logins.Succeeded(context.Background(), attempt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLoginsParallelAttempts(t *testing.T) {
+	logins, _ := newTestLogins()
+
+	const guesses = 50
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, lockedFor, err := logins.Attempt(context.Background(), types.RoleClient, "client-1", "10.0.0.1")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if lockedFor == 0 {
+				allowed++
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if allowed != userLoginThreshold {
+		t.Fatalf("expected %d password checks, got %d", userLoginThreshold, allowed)
+	}
+}
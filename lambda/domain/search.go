@@ -0,0 +1,121 @@
+package domain
+
+// Domain layer implementation for the coupon search
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"log"
+	"time"
+)
+
+// the index lives inside the lambda, so it is loaded again from the store after a while,
+// to pick up the coupons changed by other instances
+const defaultSearchIndexTTL = 5 * time.Minute
+
+func (c *Coupons) SearchCoupons(ctx context.Context, query types.CouponSearch) (types.CouponRange, error) {
+	if err := validationError(couponSearchErrors(query)); err != nil {
+		return types.CouponRange{}, err
+	}
+
+	if query.Sort == "" {
+		query.Sort = types.SearchSortNewest
+	}
+
+	query.Next = normalizeNextToken(query.Next)
+	query.Limit = pageSize(int(query.Limit))
+
+	if err := c.loadSearchIndex(ctx); err != nil {
+		return types.CouponRange{}, err
+	}
+
+	return c.search.SearchCoupons(ctx, query)
+}
+
+// the field names are the ones of the query string
+func couponSearchErrors(query types.CouponSearch) types.ValidationErrors {
+	var fieldErrors types.ValidationErrors
+
+	switch query.Sort {
+	case "", types.SearchSortNewest, types.SearchSortDiscount, types.SearchSortPrice, types.SearchSortExpiry:
+	default:
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "sort", Message: "must be one of: newest, discount, price, expiry"})
+	}
+
+	if query.MinPrice != nil && *query.MinPrice < 0 {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "minPrice", Message: "can't be negative"})
+	}
+
+	if query.MaxPrice != nil && *query.MaxPrice < 0 {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "maxPrice", Message: "can't be negative"})
+	}
+
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "maxPrice", Message: "must be greater than the minimum price"})
+	}
+
+	if query.MinDiscount != nil && (*query.MinDiscount < 0 || *query.MinDiscount > 100) {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "minDiscount", Message: "must be a percentage between 0 and 100"})
+	}
+
+	if query.ExpiringWithin != nil && *query.ExpiringWithin <= 0 {
+		fieldErrors = append(fieldErrors, types.FieldError{Field: "expiringWithinDays", Message: "must be greater than zero"})
+	}
+
+	return fieldErrors
+}
+
+// read every coupon from the store, if the index is empty or too old. This is a scan of every coupon: it is
+// meant for a catalog of a few thousand coupons. A bigger one needs an index outside the lambda, behind the
+// same types.SearchIndex. The coupons are read without holding searchMu, so only the swap of the index
+// blocks the other searches
+func (c *Coupons) loadSearchIndex(ctx context.Context) error {
+	c.searchMu.Lock()
+	stale := time.Since(c.searchLoadedAt) >= durationFromEnv("SEARCH_INDEX_TTL", defaultSearchIndexTTL)
+	c.searchMu.Unlock()
+
+	if !stale {
+		return nil
+	}
+
+	coupons := []types.Coupon{}
+	var next *string
+
+	for {
+		page, err := c.store.GetAllCoupons(ctx, next, MaxPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		coupons = append(coupons, page.Coupons...)
+
+		if page.Next == nil {
+			break
+		}
+
+		next = page.Next
+	}
+
+	c.searchMu.Lock()
+	defer c.searchMu.Unlock()
+
+	err := c.search.Rebuild(ctx, coupons)
+
+	if err != nil {
+		return err
+	}
+
+	c.searchLoadedAt = time.Now()
+
+	return nil
+}
+
+// keep the index of this instance up to date after a change. The other instances see it after their next load
+func (c *Coupons) indexCoupon(ctx context.Context, coupon types.Coupon) {
+	err := c.search.IndexCoupon(ctx, coupon)
+
+	if err != nil {
+		log.Printf("failed to index coupon %s: %v", coupon.Id, err)
+	}
+}
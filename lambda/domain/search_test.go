@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/search"
+	"OriD19/webdev2/types"
+	"context"
+	"testing"
+	"time"
+)
+
+// a store that checks that the coupons are read without holding the lock of the search index
+type lockCheckingStore struct {
+	types.CouponStore
+	coupons *Coupons
+	t       *testing.T
+}
+
+func (s *lockCheckingStore) GetAllCoupons(ctx context.Context, next *string, limit int32) (types.CouponRange, error) {
+	if s.coupons.searchMu.TryLock() {
+		s.coupons.searchMu.Unlock()
+	} else {
+		s.t.Error("expected the coupons to be read without holding searchMu")
+	}
+
+	return s.CouponStore.GetAllCoupons(ctx, next, limit)
+}
+
+func TestLoadSearchIndexReadsOutsideTheLock(t *testing.T) {
+	memory := database.NewMemoryStore()
+	now := time.Now().UTC()
+
+	memory.PutCoupon(context.Background(), types.Coupon{
+		Id:          "coupon-1",
+		Title:       "Pizza familiar",
+		CouponState: types.CouponStateActive,
+		ValidFrom:   now.Add(-time.Hour),
+		ValidUntil:  now.Add(time.Hour),
+	})
+
+	store := &lockCheckingStore{CouponStore: memory, t: t}
+	coupons := NewCouponsDomain(store, search.NewMemoryIndex(pagination.NewCodec([]byte("test"), time.Hour)))
+	store.coupons = coupons
+
+	result, err := coupons.SearchCoupons(context.Background(), types.CouponSearch{Text: "pizza"})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Coupons) != 1 || result.Coupons[0].Id != "coupon-1" {
+		t.Errorf("expected coupon-1 to be found, got %+v", result.Coupons)
+	}
+
+	if coupons.searchLoadedAt.IsZero() {
+		t.Error("expected the load time of the index to be saved")
+	}
+}
@@ -0,0 +1,256 @@
+package domain
+
+// Domain layer implementation for the sessions: refresh tokens and logout
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type Sessions struct {
+	store types.SessionStore
+}
+
+func NewSessionsDomain(s types.SessionStore) *Sessions {
+	return &Sessions{
+		store: s,
+	}
+}
+
+// create the access and refresh tokens of a user that just logged in
+func (s *Sessions) StartSession(ctx context.Context, principal types.Principal, email string) (*types.SessionTokens, error) {
+	authToken, err := types.CreateAccessToken(principal, email)
+
+	if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	refreshToken, err := newRandomToken()
+
+	if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	now := time.Now()
+
+	stored := types.RefreshToken{
+		Hash:         hashToken(refreshToken),
+		Username:     principal.Username,
+		Role:         principal.Role,
+		EnterpriseId: principal.EnterpriseId,
+		Email:        email,
+		CreatedAt:    now.UTC(),
+		ExpiresAt:    now.Add(types.RefreshTokenTTL()).Unix(),
+	}
+
+	err = s.store.PutRefreshToken(ctx, stored)
+
+	if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	return &types.SessionTokens{
+		AuthToken:    authToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(types.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// exchange a refresh token for new tokens. The refresh token is rotated: the old one can't be used again
+func (s *Sessions) Refresh(ctx context.Context, body []byte, users *Users) (*types.SessionTokens, error) {
+	var refreshRequest types.RefreshRequest
+
+	err := json.Unmarshal(body, &refreshRequest)
+
+	if err != nil {
+		return &types.SessionTokens{}, fmt.Errorf("%w", ErrJsonUnmarshal)
+	}
+
+	validate := validator.New()
+	err = validate.Struct(refreshRequest)
+
+	if err != nil {
+		return &types.SessionTokens{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	stored, err := s.store.ConsumeRefreshToken(ctx, hashToken(refreshRequest.RefreshToken))
+
+	if errors.Is(err, types.ErrNotFound) {
+		return &types.SessionTokens{}, fmt.Errorf("%w: invalid or expired refresh token", types.ErrInvalidToken)
+	} else if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	// the user may have logged out of all the sessions after this token was created
+	revoked, err := s.store.IsSessionRevoked(ctx, types.Principal{
+		Username: stored.Username,
+		Role:     stored.Role,
+		IssuedAt: stored.CreatedAt,
+	})
+
+	if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	if revoked {
+		return &types.SessionTokens{}, fmt.Errorf("%w: the session was revoked", types.ErrInvalidToken)
+	}
+
+	// read the account again, it could have been disabled or changed after the login
+	principal, email, err := users.sessionAccount(ctx, stored.Role, stored.Username)
+
+	if err != nil {
+		return &types.SessionTokens{}, err
+	}
+
+	return s.StartSession(ctx, principal, email)
+}
+
+// revoke the access token of the request and, if it is sent, the refresh token of the same session
+func (s *Sessions) Logout(ctx context.Context, principal types.Principal, body []byte) error {
+	var logoutRequest types.LogoutRequest
+
+	// the body is optional
+	if len(body) > 0 {
+		err := json.Unmarshal(body, &logoutRequest)
+
+		if err != nil {
+			return fmt.Errorf("%w", ErrJsonUnmarshal)
+		}
+	}
+
+	err := s.store.RevokeToken(ctx, principal.TokenId, principal.ExpiresAt)
+
+	if err != nil {
+		return err
+	}
+
+	if logoutRequest.RefreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.store.ConsumeRefreshToken(ctx, hashToken(logoutRequest.RefreshToken))
+
+	if errors.Is(err, types.ErrNotFound) {
+		// already used or expired, there's nothing left to revoke
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// a token of another user was consumed, give it back
+	if stored.Username != principal.Username || stored.Role != principal.Role {
+		if err := s.store.PutRefreshToken(ctx, stored); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: the refresh token belongs to another user", types.ErrForbidden)
+	}
+
+	return nil
+}
+
+// revoke every access and refresh token of the user, in every device
+func (s *Sessions) LogoutAll(ctx context.Context, principal types.Principal) error {
+	return s.store.RevokeAllSessions(ctx, principal.Role, principal.Username, time.Now())
+}
+
+// principal and email of an account that can still log in
+func (u *Users) sessionAccount(ctx context.Context, role string, username string) (types.Principal, string, error) {
+	principal := types.Principal{
+		Username: username,
+		Role:     role,
+	}
+
+	switch role {
+	case types.RoleClient:
+		client, err := u.store.GetClient(ctx, username)
+
+		if err != nil {
+			return types.Principal{}, "", sessionAccountError(err)
+		}
+
+		if client.Disabled {
+			return types.Principal{}, "", fmt.Errorf("%w: this account was disabled by an administrator", types.ErrForbidden)
+		}
+
+		return principal, client.Email, nil
+	case types.RoleEmployee:
+		employee, err := u.store.GetEmployee(ctx, username)
+
+		if err != nil {
+			return types.Principal{}, "", sessionAccountError(err)
+		}
+
+		if employee.Disabled {
+			return types.Principal{}, "", fmt.Errorf("%w: this account was disabled by an administrator", types.ErrForbidden)
+		}
+
+		principal.EnterpriseId = employee.EnterpriseId
+
+		return principal, employee.Email, nil
+	case types.RoleEnterprise:
+		enterprise, err := u.store.GetEnterprise(ctx, username)
+
+		if err != nil {
+			return types.Principal{}, "", sessionAccountError(err)
+		}
+
+		if enterprise.Deactivated || enterprise.Disabled {
+			return types.Principal{}, "", fmt.Errorf("%w: this enterprise was deactivated by an administrator", types.ErrForbidden)
+		}
+
+		// the username of an enterprise is also its id
+		principal.EnterpriseId = enterprise.Username
+
+		return principal, enterprise.Email, nil
+	case types.RoleAdministrator:
+		administrator, err := u.store.GetAdministrator(ctx, username)
+
+		if err != nil {
+			return types.Principal{}, "", sessionAccountError(err)
+		}
+
+		return principal, administrator.Email, nil
+	default:
+		return types.Principal{}, "", fmt.Errorf("%w: unknown role %s", types.ErrInvalidToken, role)
+	}
+}
+
+// the session of a deleted account is just invalid
+func sessionAccountError(err error) error {
+	if errors.Is(err, types.ErrNotFound) {
+		return fmt.Errorf("%w: the account no longer exists", types.ErrInvalidToken)
+	}
+
+	return err
+}
+
+// 32 random bytes, sent to the client as base64url. Used for the refresh tokens and the one-time tokens
+func newRandomToken() (string, error) {
+	token := make([]byte, 32)
+
+	_, err := rand.Read(token)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token, %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// only the hash is stored, so a copy of the table can't be used to refresh sessions or reset passwords
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -6,20 +6,22 @@ import (
 	"OriD19/webdev2/types"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand/v2"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 )
 
 type Users struct {
-	store types.UserStore
+	store    types.UserStore
+	sessions types.SessionStore
 }
 
-func NewUsersDomain(s types.UserStore) *Users {
+func NewUsersDomain(s types.UserStore, sessions types.SessionStore) *Users {
 	return &Users{
-		store: s,
+		store:    s,
+		sessions: sessions,
 	}
 }
 
@@ -29,21 +31,23 @@ func (u *Users) RegisterClient(ctx context.Context, body []byte) (*types.Client,
 	err := json.Unmarshal(body, &clientRegisterRequest)
 
 	if err != nil {
-		return &types.Client{}, err
+		return &types.Client{}, fmt.Errorf("%w", ErrJsonUnmarshal)
 	}
 
 	validate := validator.New()
 	err = validate.Struct(clientRegisterRequest)
 
 	if err != nil {
-		return &types.Client{}, err
+		return &types.Client{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
 	}
 
 	// check if username is not taken
 	_, err = u.store.GetClient(ctx, clientRegisterRequest.Username)
 
 	if err == nil {
-		return &types.Client{}, fmt.Errorf("username %s is already taken", clientRegisterRequest.Username)
+		return &types.Client{}, fmt.Errorf("username %s is already taken: %w", clientRegisterRequest.Username, types.ErrConflict)
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return &types.Client{}, err
 	}
 
 	// hash password before storing the user
@@ -65,6 +69,8 @@ func (u *Users) RegisterClient(ctx context.Context, body []byte) (*types.Client,
 	client.Address = clientRegisterRequest.Address
 	client.PhoneNumber = clientRegisterRequest.PhoneNumber
 	client.DUI = clientRegisterRequest.DUI
+	// verified with the link of the email sent after the registration (see Accounts.SendEmailVerification)
+	client.EmailState = types.EmailPending
 
 	err = u.store.RegisterClient(ctx, client)
 
@@ -75,27 +81,43 @@ func (u *Users) RegisterClient(ctx context.Context, body []byte) (*types.Client,
 	return &client, nil
 }
 
-func (u *Users) RegisterEmployee(ctx context.Context, body []byte) (*types.Employee, error) {
+// the employee is registered in the given enterprise, which must be active. An empty enterpriseId means
+// the caller is an administrator, so the enterprise is taken from the request body instead
+func (u *Users) RegisterEmployee(ctx context.Context, body []byte, enterpriseId string) (*types.Employee, error) {
 
 	var employeeRegisterRequest types.RegisterEmployeeRequest
 
 	err := json.Unmarshal(body, &employeeRegisterRequest)
 
 	if err != nil {
-		return &types.Employee{}, err
+		return &types.Employee{}, fmt.Errorf("%w", ErrJsonUnmarshal)
 	}
 
 	validate := validator.New()
 	err = validate.Struct(employeeRegisterRequest)
 
 	if err != nil {
+		return &types.Employee{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	if enterpriseId == "" {
+		enterpriseId = employeeRegisterRequest.EnterpriseId
+	}
+
+	if enterpriseId == "" {
+		return &types.Employee{}, fmt.Errorf("%w: enterpriseId is required", types.ErrValidation)
+	}
+
+	if _, err := u.GetActiveEnterprise(ctx, enterpriseId); err != nil {
 		return &types.Employee{}, err
 	}
 
 	_, err = u.store.GetEmployee(ctx, employeeRegisterRequest.Username)
 
 	if err == nil {
-		return &types.Employee{}, fmt.Errorf("username %s is already taken", employeeRegisterRequest.Username)
+		return &types.Employee{}, fmt.Errorf("username %s is already taken: %w", employeeRegisterRequest.Username, types.ErrConflict)
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return &types.Employee{}, err
 	}
 
 	// hash password before storing the user
@@ -116,9 +138,7 @@ func (u *Users) RegisterEmployee(ctx context.Context, body []byte) (*types.Emplo
 	employee.DUI = employeeRegisterRequest.DUI
 	employee.CreatedAt = time.Now()
 
-	// !TESTING ONLY: associate a user with a random enterprise when logging in
-	randNum := rand.IntN(5)
-	employee.EnterpriseId = EnterprisesIds[randNum]
+	employee.EnterpriseId = enterpriseId
 
 	err = u.store.RegisterEmployee(ctx, employee)
 
@@ -129,89 +149,219 @@ func (u *Users) RegisterEmployee(ctx context.Context, body []byte) (*types.Emplo
 	return &employee, nil
 }
 
-// TODO: Implement the rest of the user registration methods
-/*
-func (u *Users) RegisterEnterprise(ctx context.Context, body []byte) (*types.Enterprise, error) {
-
-	var enterprise types.Enterprise
+// only an administrator can register another one (see BootstrapAdministrator for the first one)
+func (u *Users) RegisterAdministrator(ctx context.Context, body []byte) (*types.Administrator, error) {
+	var administratorRequest types.RegisterAdministratorRequest
 
-	err := json.Unmarshal(body, &enterprise)
+	err := json.Unmarshal(body, &administratorRequest)
 
 	if err != nil {
-		return &types.Enterprise{}, err
+		return &types.Administrator{}, fmt.Errorf("%w", ErrJsonUnmarshal)
 	}
 
 	validate := validator.New()
+	err = validate.Struct(administratorRequest)
+
+	if err != nil {
+		return &types.Administrator{}, fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
 
-	err = validate.Struct(enterprise)
+	return u.createAdministrator(ctx, administratorRequest)
+}
+
+// create the first administrator of the system. Does nothing if the administrator already exists,
+// so it is safe to call on every cold start
+func (u *Users) BootstrapAdministrator(ctx context.Context, username string, email string, password string) error {
+	_, err := u.store.GetAdministrator(ctx, username)
+
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return err
+	}
+
+	administratorRequest := types.RegisterAdministratorRequest{
+		Username:  username,
+		Email:     email,
+		Password:  password,
+		FirstName: "Administrator",
+		LastName:  username,
+	}
+
+	validate := validator.New()
+	err = validate.Struct(administratorRequest)
 
 	if err != nil {
-		return &types.Enterprise{}, err
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
 	}
 
-	_, err = u.store.GetEnterprise(ctx, enterprise.Email)
+	_, err = u.createAdministrator(ctx, administratorRequest)
+
+	return err
+}
+
+func (u *Users) createAdministrator(ctx context.Context, administratorRequest types.RegisterAdministratorRequest) (*types.Administrator, error) {
+	_, err := u.store.GetAdministrator(ctx, administratorRequest.Username)
 
 	if err == nil {
-		return &types.Enterprise{}, fmt.Errorf("email %s is already taken", enterprise.Email)
+		return &types.Administrator{}, fmt.Errorf("username %s is already taken: %w", administratorRequest.Username, types.ErrConflict)
+	} else if !errors.Is(err, types.ErrNotFound) {
+		return &types.Administrator{}, err
 	}
 
 	// hash password before storing the user
-	err = enterprise.HashPassword()
+	hashedPassword, err := types.HashPassword(administratorRequest.Password)
 
 	if err != nil {
-		return &types.Enterprise{}, err
+		return &types.Administrator{}, err
 	}
 
-	err = u.store.RegisterEnterprise(ctx, enterprise)
+	administrator := types.Administrator{}
+	administrator.EntityType = "administrator"
+	administrator.Username = administratorRequest.Username
+	administrator.Email = administratorRequest.Email
+	administrator.Password = hashedPassword
+	administrator.FirstName = administratorRequest.FirstName
+	administrator.LastName = administratorRequest.LastName
+	administrator.CreatedAt = time.Now()
+
+	err = u.store.RegisterAdministrator(ctx, administrator)
 
 	if err != nil {
-		return &types.Enterprise{}, err
+		return &types.Administrator{}, err
 	}
 
-	return &enterprise, nil
+	return &administrator, nil
 }
 
-func (u *Users) RegisterAdministrator(ctx context.Context, body []byte) (*types.Administrator, error) {
-
-	var administrator types.Administrator
+// disable (or enable again) the account of a client or an employee. Disabled users can't log in,
+// and the tokens they already have are revoked
+func (u *Users) SetUserDisabled(ctx context.Context, id string, body []byte, disabled bool) error {
+	var moderateRequest types.ModerateUserRequest
 
-	err := json.Unmarshal(body, &administrator)
+	err := json.Unmarshal(body, &moderateRequest)
 
 	if err != nil {
-		return &types.Administrator{}, err
+		return fmt.Errorf("%w", ErrJsonUnmarshal)
 	}
 
 	validate := validator.New()
+	err = validate.Struct(moderateRequest)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrValidation, err)
+	}
+
+	reason := ""
+	if disabled {
+		reason = moderateRequest.Reason
+	}
+
+	// only the flag is written, so it can't undo a concurrent change of the profile
+	update := types.UserUpdate{
+		Disabled:       &disabled,
+		DisabledReason: &reason,
+	}
+
+	var role string
+
+	switch moderateRequest.UserType {
+	case "client":
+		role = types.RoleClient
+		_, err = u.store.UpdateClient(ctx, id, update)
+	case "employee":
+		role = types.RoleEmployee
+		_, err = u.store.UpdateEmployee(ctx, id, update)
+	default:
+		// the request validation only lets clients and employees through
+		return fmt.Errorf("%w: unknown user type %s", types.ErrValidation, moderateRequest.UserType)
+	}
+
+	if err != nil || !disabled {
+		return err
+	}
+
+	return u.sessions.RevokeAllSessions(ctx, role, id, time.Now())
+}
 
-	err = validate.Struct(administrator)
+func (u *Users) setClientPassword(ctx context.Context, username string, password string) error {
+	hashedPassword, err := types.HashPassword(password)
 
 	if err != nil {
-		return &types.Administrator{}, err
+		return err
 	}
 
-	_, err = u.store.GetAdministrator(ctx, administrator.Email)
+	_, err = u.store.UpdateClient(ctx, username, types.UserUpdate{Password: &hashedPassword})
 
-	if err == nil {
-		return &types.Administrator{}, fmt.Errorf("email %s is already taken", administrator.Email)
+	return err
+}
+
+// update the profile of a client, only the fields of the request are written. The second value tells whether
+// the email changed, so it has to be verified again
+func (u *Users) UpdateClientProfile(ctx context.Context, username string, body []byte) (*types.Client, bool, error) {
+	var updateRequest types.UpdateClientProfileRequest
+
+	err := json.Unmarshal(body, &updateRequest)
+
+	if err != nil {
+		return &types.Client{}, false, fmt.Errorf("%w", ErrJsonUnmarshal)
 	}
 
-	// hash password before storing the user
-	err = administrator.HashPassword()
+	validate := validator.New()
+	err = validate.Struct(updateRequest)
 
 	if err != nil {
-		return &types.Administrator{}, err
+		return &types.Client{}, false, fmt.Errorf("%w: %v", types.ErrValidation, err)
 	}
 
-	err = u.store.RegisterAdministrator(ctx, administrator)
+	client, err := u.store.GetClient(ctx, username)
 
 	if err != nil {
-		return &types.Administrator{}, err
+		return &types.Client{}, false, err
 	}
 
-	return &administrator, nil
+	update := types.UserUpdate{
+		FirstName:   updateRequest.FirstName,
+		LastName:    updateRequest.LastName,
+		Address:     updateRequest.Address,
+		PhoneNumber: updateRequest.PhoneNumber,
+	}
+
+	emailChanged := updateRequest.Email != nil && *updateRequest.Email != client.Email
+
+	if emailChanged {
+		// the email has to be the one that was compared, or the verification could be skipped
+		pending := types.EmailPending
+		update.Email = updateRequest.Email
+		update.EmailState = &pending
+		update.IfEmail = &client.Email
+	}
+
+	if update == (types.UserUpdate{}) {
+		return &client, false, nil
+	}
+
+	client, err = u.store.UpdateClient(ctx, username, update)
+
+	if err != nil {
+		return &types.Client{}, false, err
+	}
+
+	return &client, emailChanged, nil
 }
 
-*/
+// the token is only valid for the email it was sent to
+func (u *Users) setClientEmailVerified(ctx context.Context, username string, email string) error {
+	verified := types.EmailVerified
+
+	_, err := u.store.UpdateClient(ctx, username, types.UserUpdate{EmailState: &verified, IfEmail: &email})
+
+	if errors.Is(err, types.ErrConflict) {
+		return fmt.Errorf("%w: the email of the account changed, request a new verification", types.ErrInvalidToken)
+	}
+
+	return err
+}
 
 func (u *Users) GetClient(ctx context.Context, username string) (*types.Client, error) {
 	client, err := u.store.GetClient(ctx, username)
@@ -233,7 +383,6 @@ func (u *Users) GetEmployee(ctx context.Context, username string) (*types.Employ
 	return &employee, nil
 }
 
-// TODO Implement the rest of the user retrieval methods
 func (u *Users) GetEnterprise(ctx context.Context, enterpriseCode string) (*types.Enterprise, error) {
 	enterprise, err := u.store.GetEnterprise(ctx, enterpriseCode)
 
@@ -244,7 +393,6 @@ func (u *Users) GetEnterprise(ctx context.Context, enterpriseCode string) (*type
 	return &enterprise, nil
 }
 
-/*
 func (u *Users) GetAdministrator(ctx context.Context, username string) (*types.Administrator, error) {
 	administrator, err := u.store.GetAdministrator(ctx, username)
 
@@ -254,5 +402,3 @@ func (u *Users) GetAdministrator(ctx context.Context, username string) (*types.A
 
 	return &administrator, nil
 }
-
-*/
@@ -4,7 +4,10 @@ import (
 	"OriD19/webdev2/database"
 	"OriD19/webdev2/domain"
 	"OriD19/webdev2/handlers"
+	"OriD19/webdev2/mail"
 	"OriD19/webdev2/middleware"
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/search"
 	"context"
 	"os"
 
@@ -20,19 +23,36 @@ func main() {
 	}
 
 	dynamodb := database.NewDynamoDBClient(context.TODO(), tableName)
-	couponDomain := domain.NewCouponsDomain(dynamodb)
-	usersDomain := domain.NewUsersDomain(dynamodb)
-	handler := handlers.NewAPIGatewayHandler(couponDomain, usersDomain)
+	cursors, err := pagination.NewCodecFromEnv()
 
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err != nil {
+		panic(err)
+	}
+
+	couponDomain := domain.NewCouponsDomain(dynamodb, search.NewMemoryIndex(cursors))
+	usersDomain := domain.NewUsersDomain(dynamodb, dynamodb)
+	sessionsDomain := domain.NewSessionsDomain(dynamodb)
+
+	mailer, err := mail.NewMailerFromEnv(context.TODO())
+
+	if err != nil {
+		panic(err)
+	}
+
+	accountsDomain := domain.NewAccountsDomain(dynamodb, mailer)
+	loginsDomain := domain.NewLoginsDomain(dynamodb)
+	handler := handlers.NewAPIGatewayHandler(couponDomain, usersDomain, sessionsDomain, accountsDomain, loginsDomain)
+
+	// authentication and roles are checked once for every route, see middleware.RoutePolicy
+	lambda.Start(middleware.Authorize(middleware.RoutePolicy, dynamodb, func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		switch request.Resource {
 		case "/coupons":
 			switch request.HTTPMethod {
 			case "GET":
 				return handler.GetAllCouponsHandler(ctx, request)
 			case "POST":
-				// TODO add POST method for administrator to upload coupons
-				return handler.PutCouponHandler(ctx, request)
+				// enterprises and their employees publish coupons for their enterprise, administrators for any of them
+				return middleware.IdempotencyMiddleware(dynamodb, handler.PutCouponHandler)(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -49,10 +69,43 @@ func main() {
 					Body:       request.Path + " " + request.Resource + ": Not found",
 				}, nil
 			}
+		case "/coupons/search":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.SearchCouponsHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
 		case "/coupons/{couponId}":
 			switch request.HTTPMethod {
 			case "GET":
 				return handler.GetCouponHandler(ctx, request)
+			case "PUT":
+				// only the enterprise of the coupon or an administrator
+				return handler.UpdateCouponHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/coupons/{couponId}/approve":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.ApproveCouponHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/coupons/{couponId}/reject":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.RejectCouponHandler(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -62,7 +115,28 @@ func main() {
 		case "/coupons/{couponId}/buy":
 			switch request.HTTPMethod {
 			case "POST":
-				return middleware.ValidateClientJWTMiddleware(ctx, handler.BuyCouponHandler)(ctx, request)
+				return middleware.IdempotencyMiddleware(dynamodb, handler.BuyCouponHandler)(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		// enterprise portal
+		case "/enterprise/coupons":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.GetEnterpriseCouponsHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/enterprise/sales":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.GetEnterpriseSalesHandler(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -72,7 +146,7 @@ func main() {
 		case "/offers/allFromUser":
 			switch request.HTTPMethod {
 			case "GET":
-				return middleware.ValidateClientJWTMiddleware(ctx, handler.GetUserOffersHandler)(ctx, request)
+				return handler.GetUserOffersHandler(ctx, request)
 			// TODO add POST method for administrator to upload offers
 			default:
 				return events.APIGatewayProxyResponse{
@@ -85,7 +159,7 @@ func main() {
 			case "GET":
 				// we just need to know whether or not the user is authenticated to see this offer
 				// so, either an employee or a user can see an offer
-				return middleware.ValidateJWTMiddleware(ctx, handler.GetUserOfferHandler)(ctx, request)
+				return handler.GetUserOfferHandler(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -95,7 +169,7 @@ func main() {
 		case "/offers/{offerId}/redeem":
 			switch request.HTTPMethod {
 			case "POST":
-				return middleware.ValidateEmployeeJWTMiddleware(handler.RedeemCouponHandler)(ctx, request)
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RedeemCouponHandler)(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -108,5 +182,5 @@ func main() {
 				Body:       request.Path + " " + request.Resource + ": Not found",
 			}, nil
 		}
-	})
+	}))
 }
@@ -4,7 +4,10 @@ import (
 	"OriD19/webdev2/database"
 	"OriD19/webdev2/domain"
 	"OriD19/webdev2/handlers"
+	"OriD19/webdev2/mail"
+	"OriD19/webdev2/middleware"
 	"context"
+	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -19,11 +22,25 @@ func main() {
 	}
 
 	dynamodb := database.NewDynamoDBClient(context.TODO(), tableName)
-	couponDomain := domain.NewCouponsDomain(dynamodb)
-	usersDomain := domain.NewUsersDomain(dynamodb)
-	handler := handlers.NewAPIGatewayHandler(couponDomain, usersDomain)
+	usersDomain := domain.NewUsersDomain(dynamodb, dynamodb)
+	sessionsDomain := domain.NewSessionsDomain(dynamodb)
 
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	mailer, err := mail.NewMailerFromEnv(context.TODO())
+
+	if err != nil {
+		panic(err)
+	}
+
+	accountsDomain := domain.NewAccountsDomain(dynamodb, mailer)
+	loginsDomain := domain.NewLoginsDomain(dynamodb)
+	// the coupon routes and their search index are only in the coupon lambda
+	handler := handlers.NewAPIGatewayHandler(nil, usersDomain, sessionsDomain, accountsDomain, loginsDomain)
+
+	// create the first administrator, if the variables are set
+	bootstrapAdministrator(usersDomain)
+
+	// authentication and roles are checked once for every route, see middleware.RoutePolicy
+	lambda.Start(middleware.Authorize(middleware.RoutePolicy, dynamodb, func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		switch request.Resource {
 		case "/login/client":
 			switch request.HTTPMethod {
@@ -45,11 +62,133 @@ func main() {
 					Body:       request.Path + " " + request.Resource + ": Not found",
 				}, nil
 			}
+		case "/login/enterprise":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.LoginEnterprise(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/login/admin":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.LoginAdministrator(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/.well-known/jwks.json":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.JWKSHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/password/forgot":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.ForgotPasswordHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/password/reset":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.ResetPasswordHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/email/verify":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.VerifyEmailHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/email/resend":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.ResendEmailVerificationHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/refresh":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.RefreshHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/logout":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.LogoutHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/auth/logout/all":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.LogoutAllHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
 		default:
 			return events.APIGatewayProxyResponse{
 				StatusCode: 404,
 				Body:       request.Path + " " + request.Resource + ": Not found",
 			}, nil
 		}
-	})
+	}))
+}
+
+// the first administrator is created from the BOOTSTRAP_ADMIN_USERNAME, BOOTSTRAP_ADMIN_EMAIL and
+// BOOTSTRAP_ADMIN_PASSWORD variables. The rest of the administrators are registered by an administrator
+func bootstrapAdministrator(usersDomain *domain.Users) {
+	username := os.Getenv("BOOTSTRAP_ADMIN_USERNAME")
+
+	if username == "" {
+		return
+	}
+
+	err := usersDomain.BootstrapAdministrator(
+		context.TODO(),
+		username,
+		os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"),
+	)
+
+	// the login of the other users must keep working, so the error is only logged
+	if err != nil {
+		log.Printf("failed to bootstrap the administrator %s: %v", username, err)
+	}
 }
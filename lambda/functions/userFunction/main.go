@@ -4,6 +4,8 @@ import (
 	"OriD19/webdev2/database"
 	"OriD19/webdev2/domain"
 	"OriD19/webdev2/handlers"
+	"OriD19/webdev2/mail"
+	"OriD19/webdev2/middleware"
 	"context"
 	"os"
 
@@ -19,16 +21,29 @@ func main() {
 	}
 
 	dynamodb := database.NewDynamoDBClient(context.TODO(), tableName)
-	couponDomain := domain.NewCouponsDomain(dynamodb)
-	usersDomain := domain.NewUsersDomain(dynamodb)
-	handler := handlers.NewAPIGatewayHandler(couponDomain, usersDomain)
+	usersDomain := domain.NewUsersDomain(dynamodb, dynamodb)
+	sessionsDomain := domain.NewSessionsDomain(dynamodb)
 
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	mailer, err := mail.NewMailerFromEnv(context.TODO())
+
+	if err != nil {
+		panic(err)
+	}
+
+	accountsDomain := domain.NewAccountsDomain(dynamodb, mailer)
+	loginsDomain := domain.NewLoginsDomain(dynamodb)
+	// the coupon routes and their search index are only in the coupon lambda
+	handler := handlers.NewAPIGatewayHandler(nil, usersDomain, sessionsDomain, accountsDomain, loginsDomain)
+
+	// authentication and roles are checked once for every route, see middleware.RoutePolicy
+	lambda.Start(middleware.Authorize(middleware.RoutePolicy, dynamodb, func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 		switch request.Resource {
-		case "/users/{userId}/profile":
+		case "/users/{id}/profile":
 			switch request.HTTPMethod {
 			case "GET":
 				return handler.GetClient(ctx, request)
+			case "PUT":
+				return handler.UpdateClientProfile(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -38,19 +53,117 @@ func main() {
 		case "/users/client/register":
 			switch request.HTTPMethod {
 			case "POST":
-				return handler.RegisterClient(ctx, request)
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RegisterClient)(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
 					Body:       request.Path + " " + request.Resource + ": Not found",
 				}, nil
 			}
-		// !TESTING PURPOSES ONLY, employees can only be registered by an admin,
-		// but that is for the next part of the project, ofc
+		// employees can only be registered by an administrator
 		case "/users/employee/register":
 			switch request.HTTPMethod {
 			case "POST":
-				return handler.RegisterEmployee(ctx, request)
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RegisterEmployee)(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/users/administrator/register":
+			switch request.HTTPMethod {
+			case "POST":
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RegisterAdministrator)(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		// user moderation, only for administrators
+		case "/users/{id}/disable":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.DisableUser(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/users/{id}/unlock":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.UnlockUser(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/users/{id}/enable":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.EnableUser(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		// enterprise portal
+		case "/enterprise/employees":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.GetEnterpriseEmployeesHandler(ctx, request)
+			case "POST":
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RegisterEnterpriseEmployeeHandler)(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/enterprise/employees/{employeeId}":
+			switch request.HTTPMethod {
+			case "DELETE":
+				return handler.RemoveEnterpriseEmployeeHandler(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		// enterprise management, only for administrators
+		case "/enterprises":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.ListEnterprises(ctx, request)
+			case "POST":
+				return middleware.IdempotencyMiddleware(dynamodb, handler.RegisterEnterprise)(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/enterprises/{enterpriseId}":
+			switch request.HTTPMethod {
+			case "GET":
+				return handler.GetEnterprise(ctx, request)
+			case "PUT":
+				return handler.UpdateEnterprise(ctx, request)
+			default:
+				return events.APIGatewayProxyResponse{
+					StatusCode: 404,
+					Body:       request.Path + " " + request.Resource + ": Not found",
+				}, nil
+			}
+		case "/enterprises/{enterpriseId}/deactivate":
+			switch request.HTTPMethod {
+			case "POST":
+				return handler.DeactivateEnterprise(ctx, request)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -63,5 +176,5 @@ func main() {
 				Body:       request.Path + " " + request.Resource + ": Not found",
 			}, nil
 		}
-	})
+	}))
 }
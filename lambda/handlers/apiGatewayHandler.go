@@ -1,15 +1,59 @@
 package handlers
 
-import "OriD19/webdev2/domain"
+import (
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/types"
+	"context"
+	"fmt"
+)
 
 type APIGatewayHandler struct {
-	coupons *domain.Coupons
-	users   *domain.Users
+	coupons  *domain.Coupons // nil in the lambdas without the coupon routes
+	users    *domain.Users
+	sessions *domain.Sessions
+	accounts *domain.Accounts
+	logins   *domain.Logins
 }
 
-func NewAPIGatewayHandler(coupons *domain.Coupons, users *domain.Users) *APIGatewayHandler {
+func NewAPIGatewayHandler(coupons *domain.Coupons, users *domain.Users, sessions *domain.Sessions, accounts *domain.Accounts, logins *domain.Logins) *APIGatewayHandler {
 	return &APIGatewayHandler{
-		coupons: coupons,
-		users:   users,
+		coupons:  coupons,
+		users:    users,
+		sessions: sessions,
+		accounts: accounts,
+		logins:   logins,
 	}
 }
+
+// enterprise of the authenticated caller. Enterprises and employees always act for their own enterprise,
+// administrators get an empty id, so they can choose the enterprise inside the request body
+func (handler *APIGatewayHandler) callerEnterpriseId(ctx context.Context, principal types.Principal) (string, error) {
+	switch principal.Role {
+	case types.RoleAdministrator:
+		return "", nil
+	case types.RoleEnterprise:
+		return principal.EnterpriseId, nil
+	case types.RoleEmployee:
+		// read the employee again, in case it was removed from the enterprise after the token was created
+		employee, err := handler.users.GetEmployee(ctx, principal.Username)
+
+		if err != nil {
+			return "", err
+		}
+
+		return employee.EnterpriseId, nil
+	default:
+		return "", types.ErrForbidden
+	}
+}
+
+// caller of the request, saved by the authorization middleware
+func principalFromContext(ctx context.Context) (types.Principal, error) {
+	principal, ok := types.PrincipalFromContext(ctx)
+
+	if !ok {
+		return types.Principal{}, fmt.Errorf("%w: missing JWT token", types.ErrInvalidToken)
+	}
+
+	return principal, nil
+}
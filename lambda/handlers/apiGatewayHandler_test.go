@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/mail"
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/search"
+	"OriD19/webdev2/types"
+	"context"
+	"io"
+	"time"
+)
+
+// a handler over the memory store, like the lambdas build it over DynamoDB
+func newTestHandler() (*APIGatewayHandler, *database.MemoryStore) {
+	store := database.NewMemoryStore()
+	cursors := pagination.NewCodec([]byte("test"), time.Hour)
+
+	handler := NewAPIGatewayHandler(
+		domain.NewCouponsDomain(store, search.NewMemoryIndex(cursors)),
+		domain.NewUsersDomain(store, store),
+		domain.NewSessionsDomain(store),
+		domain.NewAccountsDomain(store, mail.NewWriterMailer(io.Discard)),
+		domain.NewLoginsDomain(store),
+	)
+
+	return handler, store
+}
+
+func contextAs(role string, username string) context.Context {
+	return types.ContextWithPrincipal(context.Background(), types.Principal{
+		Username: username,
+		Role:     role,
+	})
+}
@@ -1,12 +1,13 @@
 package handlers
 
 import (
-	"OriD19/webdev2/domain"
 	"OriD19/webdev2/types"
 	"context"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -14,10 +15,16 @@ import (
 func (handler *APIGatewayHandler) GetAllCouponsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	next := request.QueryStringParameters["next"]
 
-	couponsRange, err := handler.coupons.GetAllCoupons(ctx, &next)
+	limit, err := limitFromQuery(request)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	couponsRange, err := handler.coupons.GetAllCoupons(ctx, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, couponsRange), nil
@@ -33,7 +40,7 @@ func (handler *APIGatewayHandler) GetCouponHandler(ctx context.Context, request
 	coupon, err := handler.coupons.GetCoupon(ctx, id)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
 	var couponResponse types.CouponResponseType
@@ -42,16 +49,14 @@ func (handler *APIGatewayHandler) GetCouponHandler(ctx context.Context, request
 
 	enterprise, err := handler.users.GetEnterprise(ctx, coupon.EnterpriseId)
 
-	if err != nil {
+	if errors.Is(err, types.ErrNotFound) {
 		return ErrResponse(http.StatusNotFound, "enterprise code not found (possibly deleted)"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
 	couponResponse.EnterpriseDetails = *enterprise
 
-	if coupon == nil {
-		return ErrResponse(http.StatusNotFound, "coupon not found"), nil
-	}
-
 	return Response(200, couponResponse), nil
 }
 
@@ -62,39 +67,189 @@ func (handler *APIGatewayHandler) GetAllCouponsFromCategoryHandler(ctx context.C
 		return ErrResponse(http.StatusBadRequest, "missing 'category' parameter in path"), nil
 	}
 
-	couponsRange, err := handler.coupons.GetAllCouponsFromCategory(ctx, category)
+	next := request.QueryStringParameters["next"]
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	couponsRange, err := handler.coupons.GetAllCouponsFromCategory(ctx, category, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(200, couponsRange), nil
+}
+
+// search the coupons on sale: GET /coupons/search?q=pizza&category=food&minDiscount=20&sort=discount
+func (handler *APIGatewayHandler) SearchCouponsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	next := params["next"]
+
+	query := types.CouponSearch{
+		Text:         params["q"],
+		Category:     params["category"],
+		EnterpriseId: params["enterprise"],
+		Sort:         params["sort"],
+		Next:         &next,
+		Limit:        int32(limit),
+	}
+
+	query.MinPrice, err = floatFromQuery(request, "minPrice")
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	query.MaxPrice, err = floatFromQuery(request, "maxPrice")
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	// percentage, from 0 to 100
+	query.MinDiscount, err = floatFromQuery(request, "minDiscount")
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	if days, ok := params["expiringWithinDays"]; ok && days != "" {
+		daysNumber, err := strconv.Atoi(days)
+
+		if err != nil {
+			return ErrResponse(http.StatusBadRequest, "'expiringWithinDays' must be an integer"), nil
+		}
+
+		within := time.Duration(daysNumber) * 24 * time.Hour
+		query.ExpiringWithin = &within
+	}
+
+	couponsRange, err := handler.coupons.SearchCoupons(ctx, query)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, couponsRange), nil
 }
 
+// new coupons are created with a POST request to /coupons, existing ones are edited with UpdateCouponHandler
 func (handler *APIGatewayHandler) PutCouponHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	id := request.PathParameters["id"]
-	var couponId *string
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	enterpriseId, err := handler.callerEnterpriseId(ctx, principal)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	coupon, err := handler.coupons.PutCoupon(ctx, []byte(request.Body), enterpriseId, principal.Username, handler.users)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(200, coupon), nil
+}
+
+// partial update of a coupon with a PUT request to /coupons/{couponId}. Only the enterprise that owns
+// the coupon and the administrators can edit it
+func (handler *APIGatewayHandler) UpdateCouponHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["couponId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'couponId' parameter in path"), nil
+	}
 
 	if strings.TrimSpace(request.Body) == "" {
 		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
 	}
 
-	if id == "" {
-		couponId = nil
-	} else {
-		couponId = &id
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
-	coupon, err := handler.coupons.PutCoupon(ctx, couponId, []byte(request.Body), handler.users)
+	enterpriseId, err := handler.callerEnterpriseId(ctx, principal)
 
 	if err != nil {
-		if errors.Is(err, domain.ErrJsonUnmarshal) {
-			return ErrResponse(http.StatusBadRequest, err.Error()), err
-		} else if errors.Is(err, domain.ErrProductIdMismatch) {
-			return ErrResponse(http.StatusBadRequest, err.Error()), err
-		} else {
-			return ErrResponse(http.StatusInternalServerError, err.Error()), err
-		}
+		return ErrResponseFromError(err), nil
+	}
+
+	coupon, err := handler.coupons.UpdateCoupon(ctx, id, []byte(request.Body), enterpriseId)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(200, coupon), nil
+}
+
+// administrators approve the pending coupons with a POST request to /coupons/{couponId}/approve
+func (handler *APIGatewayHandler) ApproveCouponHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["couponId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'couponId' parameter in path"), nil
+	}
+
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	coupon, err := handler.coupons.ApproveCoupon(ctx, id, principal.Username)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(200, coupon), nil
+}
+
+// rejecting a coupon requires a reason in the body: {"reason": "..."}
+func (handler *APIGatewayHandler) RejectCouponHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["couponId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'couponId' parameter in path"), nil
+	}
+
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	coupon, err := handler.coupons.RejectCoupon(ctx, id, []byte(request.Body), principal.Username)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, coupon), nil
@@ -109,22 +264,38 @@ func (handler *APIGatewayHandler) RedeemCouponHandler(ctx context.Context, reque
 
 	// check if the employee is authorized to redeem the coupon
 
-	tokenString := types.ExtractTokenFromHeaders(request.Headers)
-	claims, _ := types.ParseToken(tokenString)
+	principal, err := principalFromContext(ctx)
 
-	username := claims["username"].(string)
-	employee, _ := handler.users.GetEmployee(ctx, username)
-	offer, _ := handler.coupons.GetGeneratedOffer(ctx, id)
-	coupon, _ := handler.coupons.GetCoupon(ctx, offer.CouponId)
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	employee, err := handler.users.GetEmployee(ctx, principal.Username)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	offer, err := handler.coupons.GetGeneratedOffer(ctx, id)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	coupon, err := handler.coupons.GetCoupon(ctx, offer.CouponId)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
 
 	if employee.EnterpriseId != coupon.EnterpriseId {
 		return ErrResponse(http.StatusForbidden, "you must be an employee of this enterprise to redeem this coupon"), nil
 	}
 
-	err := handler.coupons.RedeemCoupon(ctx, id)
+	err = handler.coupons.RedeemCoupon(ctx, id, *employee)
 
 	if err != nil {
-		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, "coupon redeemed successfully"), nil
@@ -138,34 +309,59 @@ func (handler *APIGatewayHandler) BuyCouponHandler(ctx context.Context, request
 		return ErrResponse(http.StatusBadRequest, "missing 'couponId' parameter in path"), nil
 	}
 
-	user, err := types.GetClientAuthFromHeader(request.Headers)
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	client, err := handler.users.GetClient(ctx, principal.Username)
 
 	if err != nil {
-		return ErrResponse(http.StatusUnauthorized, err.Error()), err
+		return ErrResponseFromError(err), nil
+	}
+
+	if !client.IsEmailVerified() {
+		return ErrResponse(http.StatusForbidden, "verify your email before buying coupons"), nil
 	}
 
 	// remember: we're using the username as the user id
-	generatedOffer, err := handler.coupons.BuyCoupon(ctx, couponId, user.Username)
+	generatedOffer, err := handler.coupons.BuyCoupon(ctx, couponId, principal.Username)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, generatedOffer), nil
 }
 
 func (handler *APIGatewayHandler) GetUserOffersHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	// DONE: extract user id from jwt token
-	client, err := types.GetClientAuthFromHeader(request.Headers)
+	principal, err := principalFromContext(ctx)
 
 	if err != nil {
-		return ErrResponse(401, "client not found"), nil
+		return ErrResponseFromError(err), nil
 	}
 
-	offers, err := handler.coupons.GetUserOffers(ctx, client.Username)
+	limit, err := limitFromQuery(request)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	next := request.QueryStringParameters["next"]
+
+	// newest offers first, unless the client asks for the opposite
+	query := types.OfferQuery{
+		Status:    request.QueryStringParameters["status"],
+		Ascending: request.QueryStringParameters["order"] == "asc",
+		Next:      &next,
+		Limit:     int32(limit),
+	}
+
+	offers, err := handler.coupons.GetUserOffers(ctx, principal.Username, query)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
 	return Response(200, offers), nil
@@ -183,32 +379,51 @@ func (handler *APIGatewayHandler) GetUserOfferHandler(ctx context.Context, reque
 	offer, err := handler.coupons.GetGeneratedOffer(ctx, offerId)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	// check two cases:
+	// check three cases:
 	// - if the user is a client, check that they are the owner of the offer
 	// - if the user is an employee, check that they are authorized to view the offer (that is, they are employees of the enterprise issuing the coupon)
+	// - if the user is an enterprise, check that it issued the coupon
+
+	principal, err := principalFromContext(ctx)
 
-	tokenString := types.ExtractTokenFromHeaders(request.Headers)
-	claims, _ := types.ParseToken(tokenString)
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	if principal.Role == types.RoleEmployee {
 
-	userRole := claims["role"].(string)
-	username := claims["username"].(string)
+		employee, err := handler.users.GetEmployee(ctx, principal.Username)
+
+		if err != nil {
+			return ErrResponseFromError(err), nil
+		}
 
-	if userRole == "employee" {
+		coupon, err := handler.coupons.GetCoupon(ctx, offer.CouponId)
 
-		employee, _ := handler.users.GetEmployee(ctx, username)
-		coupon, _ := handler.coupons.GetCoupon(ctx, offer.CouponId)
+		if err != nil {
+			return ErrResponseFromError(err), nil
+		}
 
 		if coupon.EnterpriseId != employee.EnterpriseId {
 			return ErrResponse(http.StatusForbidden, "you must be an employee of this enterprise to access this information"), nil
 		}
 
-	} else if userRole == "client" {
-		client, _ := handler.users.GetClient(ctx, username)
+	} else if principal.Role == types.RoleEnterprise {
+		coupon, err := handler.coupons.GetCoupon(ctx, offer.CouponId)
+
+		if err != nil {
+			return ErrResponseFromError(err), nil
+		}
+
+		if coupon.EnterpriseId != principal.EnterpriseId {
+			return ErrResponse(http.StatusForbidden, "this offer was not sold by your enterprise"), nil
+		}
 
-		if offer.UserId != client.Username {
+	} else if principal.Role == types.RoleClient {
+		if offer.UserId != principal.Username {
 			return ErrResponse(http.StatusForbidden, "you must be the owner of this offer to view it"), nil
 		}
 
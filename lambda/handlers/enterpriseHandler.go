@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"OriD19/webdev2/domain"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handlers for the enterprise management, only available for administrators
+
+func (handler *APIGatewayHandler) RegisterEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	enterprise, err := handler.users.RegisterEnterprise(ctx, []byte(request.Body))
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse enterprise from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, enterprise), nil
+}
+
+func (handler *APIGatewayHandler) GetEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["enterpriseId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'enterpriseId' parameter in path"), nil
+	}
+
+	enterprise, err := handler.users.GetEnterprise(ctx, id)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, enterprise), nil
+}
+
+func (handler *APIGatewayHandler) ListEnterprises(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	next := request.QueryStringParameters["next"]
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	enterprises, err := handler.users.ListEnterprises(ctx, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, enterprises), nil
+}
+
+func (handler *APIGatewayHandler) UpdateEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["enterpriseId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'enterpriseId' parameter in path"), nil
+	}
+
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	enterprise, err := handler.users.UpdateEnterprise(ctx, id, []byte(request.Body))
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, enterprise), nil
+}
+
+func (handler *APIGatewayHandler) DeactivateEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["enterpriseId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'enterpriseId' parameter in path"), nil
+	}
+
+	enterprise, err := handler.users.DeactivateEnterprise(ctx, id)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, enterprise), nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/types"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// handlers for the enterprise portal. They only work with an enterprise token,
+// and always act on the enterprise inside the token
+
+func (handler *APIGatewayHandler) GetEnterpriseCouponsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	enterpriseId, err := enterpriseIdFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	next := request.QueryStringParameters["next"]
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	coupons, err := handler.coupons.GetEnterpriseCoupons(ctx, enterpriseId, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, coupons), nil
+}
+
+func (handler *APIGatewayHandler) GetEnterpriseSalesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	enterpriseId, err := enterpriseIdFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	next := request.QueryStringParameters["next"]
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	sales, err := handler.coupons.GetEnterpriseSales(ctx, enterpriseId, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, sales), nil
+}
+
+func (handler *APIGatewayHandler) GetEnterpriseEmployeesHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	enterpriseId, err := enterpriseIdFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	next := request.QueryStringParameters["next"]
+
+	limit, err := limitFromQuery(request)
+
+	if err != nil {
+		return ErrResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	employees, err := handler.users.GetEnterpriseEmployees(ctx, enterpriseId, &next, limit)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, employees), nil
+}
+
+func (handler *APIGatewayHandler) RegisterEnterpriseEmployeeHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	enterpriseId, err := enterpriseIdFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	employee, err := handler.users.RegisterEmployee(ctx, []byte(request.Body), enterpriseId)
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse employee from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, employee), nil
+}
+
+func (handler *APIGatewayHandler) RemoveEnterpriseEmployeeHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	enterpriseId, err := enterpriseIdFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	employeeId, ok := request.PathParameters["employeeId"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'employeeId' parameter in path"), nil
+	}
+
+	err = handler.users.RemoveEmployee(ctx, enterpriseId, employeeId)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "employee removed successfully"), nil
+}
+
+// the enterprise of the token. The policy only allows enterprises on these routes
+func enterpriseIdFromContext(ctx context.Context) (string, error) {
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	if principal.Role != types.RoleEnterprise || principal.EnterpriseId == "" {
+		return "", types.ErrForbidden
+	}
+
+	return principal.EnterpriseId, nil
+}
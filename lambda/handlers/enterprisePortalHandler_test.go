@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestGetEnterpriseCouponsShowsExpiredCoupons(t *testing.T) {
+	handler, store := newTestHandler()
+	now := time.Now().UTC()
+
+	coupons := []types.Coupon{
+		{Id: "coupon-1", EnterpriseId: "TEST", CouponState: types.CouponStateActive, ValidFrom: now.Add(-48 * time.Hour), ValidUntil: now.Add(-time.Hour)},
+		{Id: "coupon-2", EnterpriseId: "TEST", CouponState: types.CouponStateActive, ValidFrom: now.Add(-48 * time.Hour), ValidUntil: now.Add(time.Hour)},
+		{Id: "coupon-3", EnterpriseId: "TEST", CouponState: types.CouponStateRejected, ValidFrom: now.Add(-48 * time.Hour), ValidUntil: now.Add(-time.Hour)},
+	}
+
+	for _, coupon := range coupons {
+		store.PutCoupon(context.Background(), coupon)
+	}
+
+	ctx := types.ContextWithPrincipal(context.Background(), types.Principal{
+		Username:     "enterprise-1",
+		Role:         types.RoleEnterprise,
+		EnterpriseId: "TEST",
+	})
+
+	response, err := handler.GetEnterpriseCouponsHandler(ctx, events.APIGatewayProxyRequest{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, response.StatusCode, response.Body)
+	}
+
+	var couponRange types.CouponRange
+
+	if err := json.Unmarshal([]byte(response.Body), &couponRange); err != nil {
+		t.Fatalf("failed to parse the response: %v", err)
+	}
+
+	want := map[string]string{
+		"coupon-1": types.CouponStateExpired,
+		"coupon-2": types.CouponStateActive,
+		"coupon-3": types.CouponStateRejected,
+	}
+
+	if len(couponRange.Coupons) != len(want) {
+		t.Fatalf("expected %d coupons, got %d", len(want), len(couponRange.Coupons))
+	}
+
+	for _, coupon := range couponRange.Coupons {
+		if coupon.CouponState != want[coupon.Id] {
+			t.Errorf("%s: expected state %s, got %s", coupon.Id, want[coupon.Id], coupon.CouponState)
+		}
+	}
+}
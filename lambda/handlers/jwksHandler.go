@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// public keys for verifying the access tokens, at GET /.well-known/jwks.json
+func (handler *APIGatewayHandler) JWKSHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	keySet, err := types.PublicKeySet()
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	response := Response(200, keySet)
+
+	// the verifiers can keep the keys for a while, a new key is published before it signs any token
+	response.Headers["Cache-Control"] = "public, max-age=300"
+
+	return response, nil
+}
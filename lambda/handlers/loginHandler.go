@@ -1,18 +1,59 @@
 package handlers
 
 import (
+	"OriD19/webdev2/domain"
 	"OriD19/webdev2/types"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/go-playground/validator/v10"
 )
 
-// for logging out, just delete the token from the client
-
 func (handler *APIGatewayHandler) LoginClient(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.login(ctx, request, types.RoleClient)
+}
+
+func (handler *APIGatewayHandler) LoginEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.login(ctx, request, types.RoleEmployee)
+}
+
+func (handler *APIGatewayHandler) LoginAdministrator(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.login(ctx, request, types.RoleAdministrator)
+}
+
+func (handler *APIGatewayHandler) LoginEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.login(ctx, request, types.RoleEnterprise)
+}
+
+// the tokens of the new session, and the account under the key of its role
+type loginResponse struct {
+	types.SessionTokens
+	Client        *types.Client        `json:"client,omitempty"`
+	Employee      *types.Employee      `json:"employee,omitempty"`
+	Enterprise    *types.Enterprise    `json:"enterprise,omitempty"`
+	Administrator *types.Administrator `json:"administrator,omitempty"`
+}
+
+// what the login needs from the account of each role
+type loginAccount struct {
+	principal    types.Principal
+	email        string
+	passwordHash string
+	// not empty when the account can't log in, even with the right password
+	disabledMessage string
+	response        loginResponse
+}
+
+func (handler *APIGatewayHandler) login(ctx context.Context, request events.APIGatewayProxyRequest, role string) (events.APIGatewayProxyResponse, error) {
 
 	var loginRequest types.LoginRequest
 
@@ -31,73 +72,162 @@ func (handler *APIGatewayHandler) LoginClient(ctx context.Context, request event
 		return ErrResponse(http.StatusBadRequest, "invalid username or password"), nil
 	}
 
-	client, err := handler.users.GetClient(ctx, loginRequest.Username)
+	attempt, lockedFor, err := handler.logins.Attempt(ctx, role, loginRequest.Username, request.RequestContext.Identity.SourceIP)
 
 	if err != nil {
-		return ErrResponse(http.StatusNotFound, err.Error()), nil
+		return ErrResponseFromError(err), nil
 	}
 
-	if !types.ValidatePassword(client.Password, loginRequest.Password) {
-		return ErrResponse(http.StatusUnauthorized, "invalid password"), nil
+	if lockedFor > 0 {
+		return loginLocked(lockedFor), nil
 	}
 
-	token := types.CreateTokenClient(*client)
+	account, err := handler.loginAccount(ctx, role, loginRequest.Username)
 
-	type LoginClientResponse struct {
-		AuthToken string       `json:"authToken"`
-		Client    types.Client `json:"client"`
+	if errors.Is(err, types.ErrNotFound) {
+		// same work and same response as a wrong password, so the usernames can't be guessed
+		types.ValidatePassword(unknownUserPasswordHash(), loginRequest.Password)
+		return invalidCredentials(), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
 	}
 
-	lcRes := LoginClientResponse{
-		AuthToken: token,
-		Client:    *client,
+	if !types.ValidatePassword(account.passwordHash, loginRequest.Password) {
+		return invalidCredentials(), nil
 	}
 
-	// create a new JWT
-	return Response(http.StatusOK, lcRes), nil
-}
+	handler.loginSucceeded(ctx, attempt, loginRequest.Username)
 
-func (handler *APIGatewayHandler) LoginEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if account.disabledMessage != "" {
+		return ErrResponse(http.StatusForbidden, account.disabledMessage), nil
+	}
 
-	var loginRequest types.LoginRequest
-
-	err := json.Unmarshal([]byte(request.Body), &loginRequest)
+	tokens, err := handler.sessions.StartSession(ctx, account.principal, account.email)
 
 	if err != nil {
-		return ErrResponse(http.StatusBadRequest, "failed to parse credentials from request body"), nil
+		return ErrResponseFromError(err), nil
 	}
 
-	// validate the login request information
-	validate := validator.New()
+	account.response.SessionTokens = *tokens
 
-	err = validate.Struct(loginRequest)
+	// create a new JWT
+	return Response(http.StatusOK, account.response), nil
+}
 
-	if err != nil {
-		return ErrResponse(http.StatusBadRequest, "invalid username or password"), nil
+func (handler *APIGatewayHandler) loginAccount(ctx context.Context, role string, username string) (loginAccount, error) {
+	switch role {
+	case types.RoleClient:
+		client, err := handler.users.GetClient(ctx, username)
+
+		if err != nil {
+			return loginAccount{}, err
+		}
+
+		account := loginAccount{
+			principal:    types.Principal{Username: client.Username, Role: role},
+			email:        client.Email,
+			passwordHash: client.Password,
+			response:     loginResponse{Client: client},
+		}
+
+		if client.Disabled {
+			account.disabledMessage = "this account was disabled by an administrator"
+		}
+
+		return account, nil
+	case types.RoleEmployee:
+		employee, err := handler.users.GetEmployee(ctx, username)
+
+		if err != nil {
+			return loginAccount{}, err
+		}
+
+		account := loginAccount{
+			principal:    types.Principal{Username: employee.Username, Role: role, EnterpriseId: employee.EnterpriseId},
+			email:        employee.Email,
+			passwordHash: employee.Password,
+			response:     loginResponse{Employee: employee},
+		}
+
+		if employee.Disabled {
+			account.disabledMessage = "this account was disabled by an administrator"
+		}
+
+		return account, nil
+	case types.RoleEnterprise:
+		enterprise, err := handler.users.GetEnterprise(ctx, username)
+
+		if err != nil {
+			return loginAccount{}, err
+		}
+
+		account := loginAccount{
+			principal:    types.Principal{Username: enterprise.Username, Role: role, EnterpriseId: enterprise.Username},
+			email:        enterprise.Email,
+			passwordHash: enterprise.Password,
+			response:     loginResponse{Enterprise: enterprise},
+		}
+
+		if enterprise.Deactivated || enterprise.Disabled {
+			account.disabledMessage = "this enterprise was deactivated by an administrator"
+		}
+
+		return account, nil
+	case types.RoleAdministrator:
+		administrator, err := handler.users.GetAdministrator(ctx, username)
+
+		if err != nil {
+			return loginAccount{}, err
+		}
+
+		return loginAccount{
+			principal:    types.Principal{Username: administrator.Username, Role: role},
+			email:        administrator.Email,
+			passwordHash: administrator.Password,
+			response:     loginResponse{Administrator: administrator},
+		}, nil
+	default:
+		return loginAccount{}, fmt.Errorf("%w: unknown role %s", types.ErrValidation, role)
 	}
+}
 
-	employee, err := handler.users.GetEmployee(ctx, loginRequest.Username)
+// ************************************************************
+// BRUTE-FORCE PROTECTION
+// ************************************************************
 
-	if err != nil {
-		return ErrResponse(http.StatusNotFound, err.Error()), nil
-	}
+// the logins are counted for the username and for the IP address (see domain.Logins).
+// Every failure gets the same response, whether the username exists or not
 
-	if !types.ValidatePassword(employee.Password, loginRequest.Password) {
-		return ErrResponse(http.StatusUnauthorized, "invalid password"), nil
-	}
+var (
+	unknownUserHashOnce sync.Once
+	unknownUserHash     string
+)
 
-	token := types.CreateTokenEmployee(*employee)
+// compared with the password of the unknown usernames, so they take as long as the wrong passwords
+func unknownUserPasswordHash() string {
+	unknownUserHashOnce.Do(func() {
+		unknownUserHash, _ = types.HashPassword("the password of an unknown user")
+	})
 
-	type LoginEmployeeReponse struct {
-		AuthToken string         `json:"authToken"`
-		Employee  types.Employee `json:"employee"`
-	}
+	return unknownUserHash
+}
 
-	leRes := LoginEmployeeReponse{
-		AuthToken: token,
-		Employee:  *employee,
-	}
+// answers with 429 and a Retry-After header while the login is locked
+func loginLocked(lockedFor time.Duration) events.APIGatewayProxyResponse {
+	response := ErrResponse(http.StatusTooManyRequests, types.ErrLoginLocked.Error())
+	response.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(lockedFor.Seconds())))
 
-	// create a new JWT
-	return Response(http.StatusOK, leRes), nil
+	return response
+}
+
+// the attempt was already counted as a failure by domain.Logins.Attempt
+func invalidCredentials() events.APIGatewayProxyResponse {
+	return ErrResponse(http.StatusUnauthorized, "invalid credentials")
+}
+
+// the password was right, so the failures of the user are forgotten
+func (handler *APIGatewayHandler) loginSucceeded(ctx context.Context, attempt domain.LoginAttempt, username string) {
+	if err := handler.logins.Succeeded(ctx, attempt); err != nil {
+		log.Printf("failed to clear the login attempts of %s: %v", username, err)
+	}
 }
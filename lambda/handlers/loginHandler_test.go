@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLoginLockout(t *testing.T) {
+	t.Setenv("SECRET", "test")
+
+	handler, store := newTestHandler()
+
+	password, err := types.HashPassword("the right password")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	employee := types.Employee{EnterpriseId: "enterprise-1"}
+	employee.Username = "employee-1"
+	employee.Password = password
+	store.RegisterEmployee(context.Background(), employee)
+
+	login := func(password string) events.APIGatewayProxyResponse {
+		body, _ := json.Marshal(types.LoginRequest{Username: "employee-1", Password: password})
+		request := events.APIGatewayProxyRequest{Body: string(body)}
+		request.RequestContext.Identity.SourceIP = "10.0.0.1"
+
+		response, err := handler.LoginEmployee(context.Background(), request)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return response
+	}
+
+	response := login("the right password")
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", response.StatusCode, response.Body)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"authToken", "refreshToken", "employee"} {
+		if _, ok := body[key]; !ok {
+			t.Errorf("expected %q in the response: %s", key, response.Body)
+		}
+	}
+
+	if _, ok := body["client"]; ok {
+		t.Errorf("expected only the account of the role in the response: %s", response.Body)
+	}
+
+	for i := 0; i < 5; i++ {
+		if response := login("a wrong password"); response.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401, got %d: %s", i, response.StatusCode, response.Body)
+		}
+	}
+
+	// locked even with the right password
+	response = login("the right password")
+
+	if response.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d: %s", response.StatusCode, response.Body)
+	}
+
+	// the lockout is stored in seconds, so a part of the first one may be gone already
+	if retryAfter := response.Headers["Retry-After"]; retryAfter != "60" && retryAfter != "59" {
+		t.Errorf("expected Retry-After of a minute, got %q", retryAfter)
+	}
+}
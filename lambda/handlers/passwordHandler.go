@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"OriD19/webdev2/domain"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// send the password reset email: {"username": "..."}. The response is the same whether the user exists or not
+func (handler *APIGatewayHandler) ForgotPasswordHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	err := handler.accounts.ForgotPassword(ctx, []byte(request.Body), handler.users)
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse username from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusAccepted, "if the account exists, an email with the instructions was sent"), nil
+}
+
+// set a new password with the token of the email: {"token": "...", "password": "..."}
+func (handler *APIGatewayHandler) ResetPasswordHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	err := handler.accounts.ResetPassword(ctx, []byte(request.Body), handler.users, handler.sessions)
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse password reset from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "password changed successfully, log in again"), nil
+}
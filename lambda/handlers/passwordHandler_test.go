@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/mail"
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/search"
+	"OriD19/webdev2/types"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, mail.Message) error {
+	return errors.New("the mail server is down")
+}
+
+func TestForgotPasswordHidesMailerFailures(t *testing.T) {
+	store := database.NewMemoryStore()
+	cursors := pagination.NewCodec([]byte("test"), time.Hour)
+
+	handler := NewAPIGatewayHandler(
+		domain.NewCouponsDomain(store, search.NewMemoryIndex(cursors)),
+		domain.NewUsersDomain(store, store),
+		domain.NewSessionsDomain(store),
+		domain.NewAccountsDomain(store, failingMailer{}),
+		domain.NewLoginsDomain(store),
+	)
+
+	client := types.Client{}
+	client.Username = "client-1"
+	client.Email = "client@example.com"
+	store.RegisterClient(context.Background(), client)
+
+	for _, username := range []string{"client-1", "missing"} {
+		response, err := handler.ForgotPasswordHandler(context.Background(), events.APIGatewayProxyRequest{
+			Body: `{"username":"` + username + `"}`,
+		})
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", username, err)
+		}
+
+		if response.StatusCode != http.StatusAccepted {
+			t.Errorf("%s: expected status %d, got %d: %s", username, http.StatusAccepted, response.StatusCode, response.Body)
+		}
+	}
+}
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/types"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -44,3 +51,78 @@ func ErrResponse(code int, body string) events.APIGatewayProxyResponse {
 		Body: string(messageBytes),
 	}
 }
+
+// translate the errors returned by the domain and the stores into a response.
+// Expected failures get their own status code, anything else is an internal error.
+// Handlers should return a nil Go error alongside this response, so API Gateway doesn't turn it into a 502
+func ErrResponseFromError(err error) events.APIGatewayProxyResponse {
+	var fieldErrors types.ValidationErrors
+
+	switch {
+	case errors.Is(err, types.ErrNotFound):
+		return ErrResponse(http.StatusNotFound, err.Error())
+	case errors.Is(err, types.ErrInvalidToken):
+		return ErrResponse(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, types.ErrForbidden):
+		return ErrResponse(http.StatusForbidden, err.Error())
+	case errors.Is(err, types.ErrConflict), errors.Is(err, types.ErrAlreadyRedeemed), errors.Is(err, types.ErrInvalidState):
+		return ErrResponse(http.StatusConflict, err.Error())
+	case errors.Is(err, types.ErrSoldOut), errors.Is(err, types.ErrExpired):
+		return ErrResponse(http.StatusGone, err.Error())
+	case errors.Is(err, types.ErrPurchaseLimit):
+		return ErrResponse(http.StatusUnprocessableEntity, err.Error())
+	case errors.As(err, &fieldErrors):
+		// one message for each invalid field
+		return Response(http.StatusUnprocessableEntity, map[string]interface{}{
+			"message": types.ErrValidation.Error(),
+			"errors":  fieldErrors,
+		})
+	case errors.Is(err, types.ErrValidation):
+		return ErrResponse(http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, domain.ErrJsonUnmarshal),
+		errors.Is(err, domain.ErrProductIdMismatch),
+		errors.Is(err, domain.ErrInvalidOfferStatus),
+		errors.Is(err, pagination.ErrInvalidCursor):
+		return ErrResponse(http.StatusBadRequest, err.Error())
+	default:
+		// don't leak the internal details to the client
+		log.Printf("internal error: %v", err)
+		return ErrResponse(http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// read the optional 'limit' query parameter of the list endpoints. Zero means "use the default"
+func limitFromQuery(request events.APIGatewayProxyRequest) (int, error) {
+	limitString, ok := request.QueryStringParameters["limit"]
+
+	if !ok || limitString == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("'limit' must be a positive integer")
+	}
+
+	return limit, nil
+}
+
+// nil when the parameter is not in the query string
+func floatFromQuery(request events.APIGatewayProxyRequest, name string) (*float32, error) {
+	valueString, ok := request.QueryStringParameters[name]
+
+	if !ok || valueString == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(valueString, 32)
+
+	if err != nil {
+		return nil, fmt.Errorf("'%s' must be a number", name)
+	}
+
+	number := float32(value)
+
+	return &number, nil
+}
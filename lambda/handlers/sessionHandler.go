@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"OriD19/webdev2/domain"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// exchange a refresh token for a new pair of tokens: {"refreshToken": "..."}
+func (handler *APIGatewayHandler) RefreshHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tokens, err := handler.sessions.Refresh(ctx, []byte(request.Body), handler.users)
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse refresh token from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, tokens), nil
+}
+
+// revoke the token of the request. The refresh token of the session can be sent in the body too
+func (handler *APIGatewayHandler) LogoutHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	err = handler.sessions.Logout(ctx, principal, []byte(request.Body))
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse refresh token from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "logged out successfully"), nil
+}
+
+// revoke every session of the caller, in every device
+func (handler *APIGatewayHandler) LogoutAllHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	err = handler.sessions.LogoutAll(ctx, principal)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "logged out of all the sessions"), nil
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"OriD19/webdev2/domain"
+	"OriD19/webdev2/types"
 	"context"
 	"errors"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -17,102 +20,198 @@ func (handler *APIGatewayHandler) RegisterClient(ctx context.Context, request ev
 	if errors.Is(err, domain.ErrJsonUnmarshal) {
 		return ErrResponse(http.StatusBadRequest, "failed to parse client from request body"), nil
 	} else if err != nil {
-		return ErrResponse(http.StatusBadRequest, "username already taken"), nil
+		return ErrResponseFromError(err), nil
+	}
+
+	// the client is already registered, so it can ask for the email again with /auth/email/resend
+	if err := handler.accounts.SendEmailVerification(ctx, client); err != nil {
+		log.Printf("failed to send the verification email to %s: %v", client.Username, err)
 	}
 
 	return Response(http.StatusOK, client), nil
 }
 
-/*
-func (handler *APIGatewayHandler) RegisterEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (handler *APIGatewayHandler) RegisterEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	enterpriseId, err := handler.callerEnterpriseId(ctx, principal)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
 
-	enterprise, err := handler.users.RegisterEnterprise(ctx, []byte(request.Body))
+	employee, err := handler.users.RegisterEmployee(ctx, []byte(request.Body), enterpriseId)
 
 	if errors.Is(err, domain.ErrJsonUnmarshal) {
-		return ErrResponse(http.StatusBadRequest, "failed to parse enterprise from request body"), err
+		return ErrResponse(http.StatusBadRequest, "failed to parse employee from request body"), nil
 	} else if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	return Response(http.StatusOK, enterprise), nil
+	return Response(http.StatusOK, employee), nil
 }
-*/
 
-func (handler *APIGatewayHandler) RegisterEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (handler *APIGatewayHandler) RegisterAdministrator(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 
-	employee, err := handler.users.RegisterEmployee(ctx, []byte(request.Body))
+	administrator, err := handler.users.RegisterAdministrator(ctx, []byte(request.Body))
 
 	if errors.Is(err, domain.ErrJsonUnmarshal) {
-		return ErrResponse(http.StatusBadRequest, "failed to parse employee from request body"), err
+		return ErrResponse(http.StatusBadRequest, "failed to parse administrator from request body"), nil
 	} else if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	return Response(http.StatusOK, employee), nil
+	return Response(http.StatusOK, administrator), nil
 }
 
-func (handler *APIGatewayHandler) GetClient(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	id, ok := request.PathParameters["userId"]
+// the body must say which type of user is disabled: {"userType": "client", "reason": "..."}
+func (handler *APIGatewayHandler) DisableUser(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.setUserDisabled(ctx, request, true)
+}
+
+func (handler *APIGatewayHandler) EnableUser(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler.setUserDisabled(ctx, request, false)
+}
+
+// clear the failed logins of a user, so it can log in again before its lockout ends: {"userType": "client"}
+func (handler *APIGatewayHandler) UnlockUser(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["id"]
 
 	if !ok {
 		return ErrResponse(http.StatusBadRequest, "missing 'id' parameter in path"), nil
 	}
 
-	// we use the username as the userId
-	client, err := handler.users.GetClient(ctx, id)
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	err := handler.logins.Unlock(ctx, id, []byte(request.Body))
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse user type from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "user unlocked successfully"), nil
+}
+
+func (handler *APIGatewayHandler) setUserDisabled(ctx context.Context, request events.APIGatewayProxyRequest, disabled bool) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["id"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'id' parameter in path"), nil
+	}
+
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	err := handler.users.SetUserDisabled(ctx, id, []byte(request.Body), disabled)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	if client == nil {
-		return ErrResponse(http.StatusNotFound, "client not found"), nil
+	if disabled {
+		return Response(http.StatusOK, "user disabled successfully"), nil
 	}
 
-	return Response(http.StatusOK, client), nil
+	return Response(http.StatusOK, "user enabled successfully"), nil
 }
 
-func (handler *APIGatewayHandler) GetEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (handler *APIGatewayHandler) GetClient(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	id, ok := request.PathParameters["id"]
 
 	if !ok {
 		return ErrResponse(http.StatusBadRequest, "missing 'id' parameter in path"), nil
 	}
 
-	employee, err := handler.users.GetEmployee(ctx, id)
+	principal, err := principalFromContext(ctx)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	if employee == nil {
-		return ErrResponse(http.StatusNotFound, "employee not found"), nil
+	// the profile has personal data (DUI, address, phone...), so clients can only read their own
+	if principal.Role != types.RoleAdministrator && principal.Username != id {
+		return ErrResponse(http.StatusForbidden, "you can only see your own profile"), nil
 	}
 
-	return Response(http.StatusOK, employee), nil
+	// we use the username as the userId
+	client, err := handler.users.GetClient(ctx, id)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, client), nil
 }
 
-/*
-func (handler *APIGatewayHandler) GetEnterprise(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// partial update of the profile of a client, with a PUT request to /users/{id}/profile.
+// Clients can only update their own profile, administrators can update any of them
+func (handler *APIGatewayHandler) UpdateClientProfile(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	id, ok := request.PathParameters["id"]
 
 	if !ok {
 		return ErrResponse(http.StatusBadRequest, "missing 'id' parameter in path"), nil
 	}
 
-	enterprise, err := handler.users.GetEnterprise(ctx, id)
+	if strings.TrimSpace(request.Body) == "" {
+		return ErrResponse(http.StatusBadRequest, "missing request body"), nil
+	}
+
+	principal, err := principalFromContext(ctx)
 
 	if err != nil {
-		return ErrResponse(http.StatusInternalServerError, err.Error()), err
+		return ErrResponseFromError(err), nil
 	}
 
-	if enterprise == nil {
-		return ErrResponse(http.StatusNotFound, "enterprise not found"), nil
+	if principal.Role != types.RoleAdministrator && principal.Username != id {
+		return ErrResponse(http.StatusForbidden, "you can only update your own profile"), nil
 	}
 
-	return Response(http.StatusOK, enterprise), nil
+	client, emailChanged, err := handler.users.UpdateClientProfile(ctx, id, []byte(request.Body))
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse profile from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	// the new email must be verified before buying coupons again
+	if emailChanged {
+		if err := handler.accounts.SendEmailVerification(ctx, client); err != nil {
+			log.Printf("failed to send the verification email to %s: %v", client.Username, err)
+		}
+	}
+
+	// the password is never serialized (see types.User)
+	return Response(http.StatusOK, client), nil
 }
 
+func (handler *APIGatewayHandler) GetEmployee(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	id, ok := request.PathParameters["id"]
+
+	if !ok {
+		return ErrResponse(http.StatusBadRequest, "missing 'id' parameter in path"), nil
+	}
+
+	employee, err := handler.users.GetEmployee(ctx, id)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, employee), nil
+}
+
+/*
 func (handler *APIGatewayHandler) GetAdministrator(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	id, ok := request.PathParameters["id"]
 
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"OriD19/webdev2/types"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestGetClientProfileOnlyForOwner(t *testing.T) {
+	handler, store := newTestHandler()
+
+	for _, username := range []string{"client-1", "client-2"} {
+		client := types.Client{DUI: "00000000-0"}
+		client.Username = username
+		store.RegisterClient(context.Background(), client)
+	}
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": "client-1"},
+	}
+
+	tests := []struct {
+		name     string
+		role     string
+		username string
+		want     int
+	}{
+		{"owner", types.RoleClient, "client-1", http.StatusOK},
+		{"another client", types.RoleClient, "client-2", http.StatusForbidden},
+		{"administrator", types.RoleAdministrator, "admin-1", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		response, err := handler.GetClient(contextAs(test.role, test.username), request)
+
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		if response.StatusCode != test.want {
+			t.Errorf("%s: expected status %d, got %d: %s", test.name, test.want, response.StatusCode, response.Body)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"OriD19/webdev2/domain"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// verify the email of a client with the token of the email: {"token": "..."}
+func (handler *APIGatewayHandler) VerifyEmailHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	err := handler.accounts.VerifyEmail(ctx, []byte(request.Body), handler.users)
+
+	if errors.Is(err, domain.ErrJsonUnmarshal) {
+		return ErrResponse(http.StatusBadRequest, "failed to parse token from request body"), nil
+	} else if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusOK, "email verified successfully"), nil
+}
+
+// send the verification email again to the client of the token
+func (handler *APIGatewayHandler) ResendEmailVerificationHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	principal, err := principalFromContext(ctx)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	err = handler.accounts.ResendEmailVerification(ctx, principal.Username, handler.users)
+
+	if err != nil {
+		return ErrResponseFromError(err), nil
+	}
+
+	return Response(http.StatusAccepted, "the verification email was sent again"), nil
+}
@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// delivery of the emails sent by the API (password reset, verification, ...).
+// The deployed stack sends them through SES, local deployments write them to stdout or to a file, see NewMailerFromEnv
+
+var ErrLocalMailerDeployed = errors.New("the stdout mailer is only for local development, use MAIL_PROVIDER=ses inside a lambda")
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(context.Context, Message) error
+}
+
+// writes every email to an io.Writer, for local development
+type WriterMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterMailer(w io.Writer) *WriterMailer {
+	return &WriterMailer{
+		w: w,
+	}
+}
+
+func (m *WriterMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "From: %s\nTo: %s\nSubject: %s\n\n%s\n----\n", message.From, message.To, message.Subject, message.Body)
+
+	if err != nil {
+		return fmt.Errorf("failed to write email, %v", err)
+	}
+
+	return nil
+}
+
+// MAIL_PROVIDER chooses how the emails are delivered:
+//   - "ses": through Amazon SES, for the deployed stack
+//   - "stdout": written to stdout, or appended to the MAIL_OUTPUT file. Only for local development,
+//     the emails have single use links that must never end up in the logs of a deployed lambda
+func NewMailerFromEnv(ctx context.Context) (Mailer, error) {
+	switch provider := os.Getenv("MAIL_PROVIDER"); provider {
+	case "ses":
+		cfg, err := config.LoadDefaultConfig(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to load SDK config, %v", err)
+		}
+
+		return NewSESMailer(sesv2.NewFromConfig(cfg)), nil
+	case "stdout":
+		// the lambda runtime always sets this variable
+		if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+			return nil, ErrLocalMailerDeployed
+		}
+
+		path := os.Getenv("MAIL_OUTPUT")
+
+		if path == "" {
+			return NewWriterMailer(os.Stdout), nil
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to open MAIL_OUTPUT, %v", err)
+		}
+
+		return NewWriterMailer(file), nil
+	default:
+		return nil, fmt.Errorf("MAIL_PROVIDER must be \"ses\" or \"stdout\", got %q", provider)
+	}
+}
+
+// sender of the emails. Configurable with MAIL_FROM
+func Sender() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+
+	return "La Cuponera <no-reply@lacuponera.com>"
+}
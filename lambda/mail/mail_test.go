@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+type fakeSES struct {
+	input *sesv2.SendEmailInput
+}
+
+func (f *fakeSES) SendEmail(ctx context.Context, input *sesv2.SendEmailInput, options ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error) {
+	f.input = input
+	return &sesv2.SendEmailOutput{}, nil
+}
+
+func TestSESMailerSend(t *testing.T) {
+	client := &fakeSES{}
+	mailer := &SESMailer{client: client}
+
+	err := mailer.Send(context.Background(), Message{
+		From:    "La Cuponera <no-reply@lacuponera.com>",
+		To:      "client@example.com",
+		Subject: "Restablece tu contraseña",
+		Body:    "https://lacuponera.com/reset?token=abc",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := client.input.Destination.ToAddresses; len(got) != 1 || got[0] != "client@example.com" {
+		t.Errorf("unexpected recipients: %v", got)
+	}
+
+	if got := aws.ToString(client.input.Content.Simple.Body.Text.Data); got != "https://lacuponera.com/reset?token=abc" {
+		t.Errorf("unexpected body: %s", got)
+	}
+}
+
+func TestNewMailerFromEnv(t *testing.T) {
+	t.Setenv("MAIL_PROVIDER", "")
+
+	if _, err := NewMailerFromEnv(context.Background()); err == nil {
+		t.Errorf("expected an error without MAIL_PROVIDER")
+	}
+
+	t.Setenv("MAIL_PROVIDER", "stdout")
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "")
+
+	if _, err := NewMailerFromEnv(context.Background()); err != nil {
+		t.Errorf("unexpected error for local development: %v", err)
+	}
+
+	// the emails would end up in CloudWatch
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "LaCuponeraUsersLambda")
+
+	if _, err := NewMailerFromEnv(context.Background()); !errors.Is(err, ErrLocalMailerDeployed) {
+		t.Errorf("expected %v inside a lambda, got %v", ErrLocalMailerDeployed, err)
+	}
+}
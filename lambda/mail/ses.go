@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// the subset of the SES client used for sending, so it can be replaced in the tests
+type sesSender interface {
+	SendEmail(context.Context, *sesv2.SendEmailInput, ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// sends the emails through Amazon SES. The sender (MAIL_FROM) must be a verified identity of the account
+type SESMailer struct {
+	client sesSender
+}
+
+func NewSESMailer(client *sesv2.Client) *SESMailer {
+	return &SESMailer{
+		client: client,
+	}
+}
+
+func (m *SESMailer) Send(ctx context.Context, message Message) error {
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(message.From),
+		Destination: &sestypes.Destination{
+			ToAddresses: []string{message.To},
+		},
+		Content: &sestypes.EmailContent{
+			Simple: &sestypes.Message{
+				Subject: &sestypes.Content{
+					Data:    aws.String(message.Subject),
+					Charset: aws.String("UTF-8"),
+				},
+				Body: &sestypes.Body{
+					Text: &sestypes.Content{
+						Data:    aws.String(message.Body),
+						Charset: aws.String("UTF-8"),
+					},
+				},
+			},
+		},
+	}
+
+	// the message is never included in the error, it has the single use links
+	_, err := m.client.SendEmail(ctx, input)
+
+	if err != nil {
+		return fmt.Errorf("failed to send email through SES, %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// every email is sent in Spanish first, and then in English
+
+type PasswordResetData struct {
+	Name      string
+	Link      string
+	Token     string
+	ExpiresIn int // minutes
+}
+
+var passwordResetTemplates = map[string]*template.Template{
+	"es": template.Must(template.New("passwordReset.es").Parse(`Hola {{.Name}},
+
+Recibimos una solicitud para restablecer la contraseña de tu cuenta de La Cuponera.
+Para elegir una nueva contraseña, abre este enlace:
+
+{{.Link}}
+
+O usa este código: {{.Token}}
+
+El enlace vence en {{.ExpiresIn}} minutos y solo se puede usar una vez.
+Si no fuiste tú, ignora este correo: tu contraseña no cambiará.`)),
+	"en": template.Must(template.New("passwordReset.en").Parse(`Hi {{.Name}},
+
+We received a request to reset the password of your La Cuponera account.
+To choose a new password, open this link:
+
+{{.Link}}
+
+Or use this code: {{.Token}}
+
+The link expires in {{.ExpiresIn}} minutes and can only be used once.
+If it wasn't you, ignore this email: your password won't change.`)),
+}
+
+type EmailVerificationData struct {
+	Name      string
+	Link      string
+	Token     string
+	ExpiresIn int // hours
+}
+
+var emailVerificationTemplates = map[string]*template.Template{
+	"es": template.Must(template.New("emailVerification.es").Parse(`Hola {{.Name}},
+
+Gracias por registrarte en La Cuponera. Para confirmar tu correo, abre este enlace:
+
+{{.Link}}
+
+O usa este código: {{.Token}}
+
+El enlace vence en {{.ExpiresIn}} horas. Necesitas confirmar tu correo antes de comprar cupones.`)),
+	"en": template.Must(template.New("emailVerification.en").Parse(`Hi {{.Name}},
+
+Thanks for signing up to La Cuponera. To confirm your email, open this link:
+
+{{.Link}}
+
+Or use this code: {{.Token}}
+
+The link expires in {{.ExpiresIn}} hours. You need to confirm your email before buying coupons.`)),
+}
+
+func PasswordResetMessage(to string, data PasswordResetData) (Message, error) {
+	body, err := renderBilingual(passwordResetTemplates, data)
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		From:    Sender(),
+		To:      to,
+		Subject: "Restablece tu contraseña / Reset your password",
+		Body:    body,
+	}, nil
+}
+
+func EmailVerificationMessage(to string, data EmailVerificationData) (Message, error) {
+	body, err := renderBilingual(emailVerificationTemplates, data)
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		From:    Sender(),
+		To:      to,
+		Subject: "Confirma tu correo / Confirm your email",
+		Body:    body,
+	}, nil
+}
+
+func renderBilingual(templates map[string]*template.Template, data interface{}) (string, error) {
+	var body strings.Builder
+
+	for i, language := range []string{"es", "en"} {
+		if i > 0 {
+			body.WriteString("\n\n----------\n\n")
+		}
+
+		err := templates[language].Execute(&body, data)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to render the %s email, %v", language, err)
+		}
+	}
+
+	return body.String(), nil
+}
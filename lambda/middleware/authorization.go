@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"OriD19/webdev2/handlers"
+	"OriD19/webdev2/types"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// middleware for authenticating the caller and checking its role against the Policy table.
+// The caller is saved in the context as a types.Principal, so the handlers don't need to parse the token again
+
+type HandlerFunc func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Authorize must wrap the whole router of a lambda. Routes missing from the policy are not found.
+// Tokens revoked with a logout are rejected like the invalid ones
+func Authorize(policy Policy, sessions types.SessionStore, next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		roles, ok := policy[request.HTTPMethod+" "+request.Resource]
+
+		if !ok {
+			return handlers.ErrResponse(http.StatusNotFound, request.Path+": not found"), nil
+		}
+
+		tokenString := strings.TrimSpace(types.ExtractTokenFromHeaders(request.Headers))
+
+		if roles == nil {
+			// the public routes still know who the caller is, when a valid token is sent
+			if principal, err := types.ParsePrincipal(tokenString); tokenString != "" && err == nil {
+				if revoked, err := sessions.IsSessionRevoked(ctx, principal); err == nil && !revoked {
+					ctx = types.ContextWithPrincipal(ctx, principal)
+				}
+			}
+
+			return next(ctx, request)
+		}
+
+		if tokenString == "" {
+			return handlers.ErrResponse(http.StatusUnauthorized, "missing JWT token"), nil
+		}
+
+		principal, err := types.ParsePrincipal(tokenString)
+
+		if err != nil {
+			return handlers.ErrResponse(http.StatusUnauthorized, err.Error()), nil
+		}
+
+		revoked, err := sessions.IsSessionRevoked(ctx, principal)
+
+		if err != nil {
+			return handlers.ErrResponseFromError(err), nil
+		}
+
+		if revoked {
+			return handlers.ErrResponse(http.StatusUnauthorized, "the token was revoked"), nil
+		}
+
+		// authenticated, but not allowed to use this route
+		if !slices.Contains(roles, principal.Role) {
+			return handlers.ErrResponse(http.StatusForbidden, "not authorized for this action"), nil
+		}
+
+		return next(types.ContextWithPrincipal(ctx, principal), request)
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/domain"
+	"OriD19/webdev2/types"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAuthorizeRejectsTokensOfDisabledUsers(t *testing.T) {
+	t.Setenv("SECRET", "test-secret")
+
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	users := domain.NewUsersDomain(store, store)
+
+	client := types.Client{}
+	client.Username = "client-1"
+	store.RegisterClient(ctx, client)
+
+	token, err := types.CreateAccessToken(types.Principal{Username: "client-1", Role: types.RoleClient}, "client@example.com")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	policy := Policy{"GET /profile": {types.RoleClient}}
+	handler := Authorize(policy, store, func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+	})
+
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodGet,
+		Resource:   "/profile",
+		Headers:    map[string]string{"Authorization": "Bearer " + token},
+	}
+
+	if response, _ := handler(ctx, request); response.StatusCode != http.StatusOK {
+		t.Fatalf("expected the token to be valid before disabling the user, got %d: %s", response.StatusCode, response.Body)
+	}
+
+	// the revocation has the precision of the issue date, which is in seconds
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	err = users.SetUserDisabled(ctx, "client-1", []byte(`{"userType":"client","reason":"spam"}`), true)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d: %s", http.StatusUnauthorized, response.StatusCode, response.Body)
+	}
+}
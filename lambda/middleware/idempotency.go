@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"OriD19/webdev2/handlers"
+	"OriD19/webdev2/types"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// middleware for replaying the first response of a request sent with an Idempotency-Key header
+
+const idempotencyHeader = "Idempotency-Key"
+
+// how long a stored response can be replayed. Configurable with the IDEMPOTENCY_TTL variable (for example, "24h")
+var idempotencyTTL = durationFromEnv("IDEMPOTENCY_TTL", 24*time.Hour)
+
+func IdempotencyMiddleware(store types.IdempotencyStore, next func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		key := strings.TrimSpace(headerValue(request.Headers, idempotencyHeader))
+
+		// the header is optional
+		if key == "" {
+			return next(ctx, request)
+		}
+
+		if len(key) > 255 {
+			return handlers.ErrResponse(http.StatusBadRequest, "Idempotency-Key must have at most 255 characters"), nil
+		}
+
+		now := time.Now()
+
+		// keys are scoped to the caller, so two clients can't see each other's responses
+		record := types.IdempotencyRecord{
+			Key:         callerId(ctx, request) + "#" + key,
+			RequestHash: requestHash(request),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyTTL).Unix(),
+		}
+
+		err := store.ReserveIdempotencyKey(ctx, record)
+
+		if errors.Is(err, types.ErrConflict) {
+			return replayResponse(ctx, store, record)
+		} else if err != nil {
+			return handlers.ErrResponseFromError(err), nil
+		}
+
+		response, err := next(ctx, request)
+
+		// server errors are not stored, so the client can retry with the same key
+		if err != nil || response.StatusCode >= 500 {
+			if releaseErr := store.ReleaseIdempotencyKey(ctx, record.Key); releaseErr != nil {
+				log.Printf("failed to release idempotency key: %v", releaseErr)
+			}
+
+			return response, err
+		}
+
+		record.Completed = true
+		record.StatusCode = response.StatusCode
+		record.ResponseBody = response.Body
+
+		// the request was already processed, so a failure here only affects future retries
+		if err := store.CompleteIdempotencyKey(ctx, record); err != nil {
+			log.Printf("failed to store idempotent response: %v", err)
+		}
+
+		return response, nil
+	}
+}
+
+// answer a request whose key was already used
+func replayResponse(ctx context.Context, store types.IdempotencyStore, record types.IdempotencyRecord) (events.APIGatewayProxyResponse, error) {
+	existing, err := store.GetIdempotencyRecord(ctx, record.Key)
+
+	// the key was released (or expired) after the reservation failed
+	if errors.Is(err, types.ErrNotFound) {
+		return handlers.ErrResponse(http.StatusConflict, "the request with this Idempotency-Key failed, try again"), nil
+	} else if err != nil {
+		return handlers.ErrResponseFromError(err), nil
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		return handlers.ErrResponse(http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request"), nil
+	}
+
+	if !existing.Completed {
+		return handlers.ErrResponse(http.StatusConflict, "a request with this Idempotency-Key is still being processed"), nil
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: existing.StatusCode,
+		Headers: map[string]string{
+			"Content-Type":                "application/json",
+			"Access-Control-Allow-Origin": "*",
+			"Idempotent-Replayed":         "true",
+		},
+		Body: existing.ResponseBody,
+	}, nil
+}
+
+// the role and username inside the token (the usernames are only unique for each role),
+// or the IP address for anonymous requests
+func callerId(ctx context.Context, request events.APIGatewayProxyRequest) string {
+	if principal, ok := types.PrincipalFromContext(ctx); ok {
+		return principal.Role + "#" + principal.Username
+	}
+
+	return "ip#" + request.RequestContext.Identity.SourceIP
+}
+
+// the same key can only be used again with the same method, path and body
+func requestHash(request events.APIGatewayProxyRequest) string {
+	hash := sha256.Sum256([]byte(request.HTTPMethod + " " + request.Path + "\n" + request.Body))
+	return hex.EncodeToString(hash[:])
+}
+
+// header names are case insensitive, but API Gateway keeps them as the client sent them
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+
+	if err != nil || duration <= 0 {
+		return defaultValue
+	}
+
+	return duration
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"OriD19/webdev2/database"
+	"OriD19/webdev2/types"
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestCallerIdIncludesRole(t *testing.T) {
+	var request events.APIGatewayProxyRequest
+	request.RequestContext.Identity.SourceIP = "10.0.0.1"
+
+	client := types.ContextWithPrincipal(context.Background(), types.Principal{Username: "acme", Role: types.RoleClient})
+	enterprise := types.ContextWithPrincipal(context.Background(), types.Principal{Username: "acme", Role: types.RoleEnterprise})
+
+	if callerId(client, request) == callerId(enterprise, request) {
+		t.Errorf("expected different callers for the same username with different roles, got %q", callerId(client, request))
+	}
+
+	if got := callerId(context.Background(), request); got != "ip#10.0.0.1" {
+		t.Errorf("expected the IP address for anonymous requests, got %q", got)
+	}
+}
+
+func idempotentRequest(body string) events.APIGatewayProxyRequest {
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Path:       "/coupons/buy",
+		Headers:    map[string]string{"idempotency-key": "key-1"},
+		Body:       body,
+	}
+	request.RequestContext.Identity.SourceIP = "10.0.0.1"
+
+	return request
+}
+
+// a handler that counts its calls and answers with the given status
+func countingHandler(calls *int, statusCode int) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		*calls++
+		return events.APIGatewayProxyResponse{StatusCode: statusCode, Body: `{"call":` + strconv.Itoa(*calls) + `}`}, nil
+	}
+}
+
+func TestIdempotencyReplaysTheFirstResponse(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	handler := IdempotencyMiddleware(database.NewMemoryStore(), countingHandler(&calls, http.StatusCreated))
+
+	first, _ := handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+	replay, _ := handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", calls)
+	}
+
+	if replay.StatusCode != first.StatusCode || replay.Body != first.Body {
+		t.Errorf("expected the replay to return %d %s, got %d %s", first.StatusCode, first.Body, replay.StatusCode, replay.Body)
+	}
+
+	if replay.Headers["Idempotent-Replayed"] != "true" {
+		t.Errorf("expected the replay to be marked, got headers %v", replay.Headers)
+	}
+}
+
+func TestIdempotencyRejectsADifferentRequest(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	handler := IdempotencyMiddleware(database.NewMemoryStore(), countingHandler(&calls, http.StatusCreated))
+
+	handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+	response, _ := handler(ctx, idempotentRequest(`{"couponId":"coupon-2"}`))
+
+	if response.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected %d, got %d", http.StatusUnprocessableEntity, response.StatusCode)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyRejectsAKeyInProgress(t *testing.T) {
+	ctx := context.Background()
+	var retry events.APIGatewayProxyResponse
+	var handler func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+	// the retry arrives while the first request is still running
+	handler = IdempotencyMiddleware(database.NewMemoryStore(), func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		retry, _ = handler(ctx, request)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusCreated}, nil
+	})
+
+	handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+
+	if retry.StatusCode != http.StatusConflict {
+		t.Errorf("expected %d, got %d", http.StatusConflict, retry.StatusCode)
+	}
+}
+
+func TestIdempotencyReleasesTheKeyOnServerErrors(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	handler := IdempotencyMiddleware(database.NewMemoryStore(), countingHandler(&calls, http.StatusInternalServerError))
+
+	handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+	response, _ := handler(ctx, idempotentRequest(`{"couponId":"coupon-1"}`))
+
+	if calls != 2 {
+		t.Errorf("expected the retry to run the handler again, ran %d times", calls)
+	}
+
+	if response.Headers["Idempotent-Replayed"] == "true" {
+		t.Errorf("expected the server error not to be replayed")
+	}
+}
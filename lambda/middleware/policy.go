@@ -0,0 +1,70 @@
+package middleware
+
+import "OriD19/webdev2/types"
+
+// roles allowed for each route ("METHOD resource", as API Gateway sends them).
+// Public routes don't need a token. Every route of the API must be listed here
+
+type Policy map[string][]string
+
+// public routes have no roles
+var Public []string
+
+var (
+	administrators   = []string{types.RoleAdministrator}
+	enterprises      = []string{types.RoleEnterprise}
+	clients          = []string{types.RoleClient}
+	employees        = []string{types.RoleEmployee}
+	couponPublishers = []string{types.RoleEnterprise, types.RoleEmployee, types.RoleAdministrator}
+	anyRole          = []string{types.RoleClient, types.RoleEmployee, types.RoleEnterprise, types.RoleAdministrator}
+)
+
+var RoutePolicy = Policy{
+	// coupons
+	"GET /coupons":                              Public,
+	"POST /coupons":                             couponPublishers,
+	"GET /coupons/category/{category}":          Public,
+	"GET /coupons/search":                       Public,
+	"GET /coupons/{couponId}":                   Public,
+	"PUT /coupons/{couponId}":                   {types.RoleEnterprise, types.RoleAdministrator},
+	"POST /coupons/{couponId}/approve":          administrators,
+	"POST /coupons/{couponId}/reject":           administrators,
+	"POST /coupons/{couponId}/buy":              clients,
+	"GET /offers/allFromUser":                   clients,
+	"GET /offers/{offerId}":                     {types.RoleClient, types.RoleEmployee, types.RoleEnterprise},
+	"POST /offers/{offerId}/redeem":             employees,
+	"GET /enterprise/coupons":                   enterprises,
+	"GET /enterprise/sales":                     enterprises,
+	"GET /enterprise/employees":                 enterprises,
+	"POST /enterprise/employees":                enterprises,
+	"DELETE /enterprise/employees/{employeeId}": enterprises,
+
+	// users
+	"GET /users/{id}/profile":                     {types.RoleClient, types.RoleAdministrator},
+	"PUT /users/{id}/profile":                     {types.RoleClient, types.RoleAdministrator},
+	"POST /users/client/register":                 Public,
+	"POST /users/employee/register":               administrators,
+	"POST /users/administrator/register":          administrators,
+	"POST /users/{id}/disable":                    administrators,
+	"POST /users/{id}/enable":                     administrators,
+	"POST /users/{id}/unlock":                     administrators,
+	"GET /enterprises":                            administrators,
+	"POST /enterprises":                           administrators,
+	"GET /enterprises/{enterpriseId}":             administrators,
+	"PUT /enterprises/{enterpriseId}":             administrators,
+	"POST /enterprises/{enterpriseId}/deactivate": administrators,
+
+	// login
+	"POST /login/client":         Public,
+	"POST /login/employee":       Public,
+	"POST /login/enterprise":     Public,
+	"POST /login/admin":          Public,
+	"POST /auth/refresh":         Public,
+	"POST /auth/logout":          anyRole,
+	"POST /auth/logout/all":      anyRole,
+	"GET /.well-known/jwks.json": Public,
+	"POST /auth/password/forgot": Public,
+	"POST /auth/password/reset":  Public,
+	"POST /auth/email/verify":    Public,
+	"POST /auth/email/resend":    clients,
+}
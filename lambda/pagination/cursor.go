@@ -0,0 +1,176 @@
+package pagination
+
+// Opaque cursors for every list endpoint.
+// A cursor carries the whole LastEvaluatedKey of a query (including the keys of an index),
+// and it is signed with HMAC-SHA256, so clients can't forge one to jump to arbitrary keys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	ErrExpiredCursor = fmt.Errorf("%w: the cursor expired, start again from the first page", ErrInvalidCursor)
+
+	ErrMissingCursorSecret = errors.New("CURSOR_SECRET must be set for signing the pagination cursors")
+)
+
+const defaultCursorTTL = 24 * time.Hour
+
+type Codec struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// only string and number keys are used inside the table
+type keyValue struct {
+	S *string `json:"s,omitempty"`
+	N *string `json:"n,omitempty"`
+}
+
+type payload struct {
+	Scope   string              `json:"c"` // the list the cursor belongs to
+	Key     map[string]keyValue `json:"k"`
+	Expires int64               `json:"e"`
+}
+
+func NewCodec(secret []byte, ttl time.Duration) *Codec {
+	return &Codec{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// uses CURSOR_SECRET and CURSOR_TTL (like "24h"). The secret is required: every instance of a lambda
+// must sign with the same key, or the cursors of one instance would be rejected by the others.
+// It is a key of its own, never the one of the tokens
+func NewCodecFromEnv() (*Codec, error) {
+	secret := os.Getenv("CURSOR_SECRET")
+
+	if secret == "" {
+		return nil, ErrMissingCursorSecret
+	}
+
+	return NewCodec([]byte(secret), cursorTTL()), nil
+}
+
+// a random key, so the cursors only work inside this process. Used by the memory store
+func NewLocalCodec() *Codec {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	return NewCodec(secret, cursorTTL())
+}
+
+func cursorTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("CURSOR_TTL"))
+
+	if err != nil || ttl <= 0 {
+		return defaultCursorTTL
+	}
+
+	return ttl
+}
+
+// returns nil when there are no more pages (the key is empty)
+func (c *Codec) Encode(scope string, key map[string]ddbtypes.AttributeValue) (*string, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	p := payload{
+		Scope:   scope,
+		Key:     map[string]keyValue{},
+		Expires: time.Now().Add(c.ttl).Unix(),
+	}
+
+	for name, value := range key {
+		switch v := value.(type) {
+		case *ddbtypes.AttributeValueMemberS:
+			p.Key[name] = keyValue{S: &v.Value}
+		case *ddbtypes.AttributeValueMemberN:
+			p.Key[name] = keyValue{N: &v.Value}
+		default:
+			return nil, fmt.Errorf("unsupported type for key attribute %s", name)
+		}
+	}
+
+	data, err := json.Marshal(p)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cursor, %v", err)
+	}
+
+	cursor := base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(c.sign(data))
+
+	return &cursor, nil
+}
+
+// check the signature, the expiration and the scope of the cursor, and return the key inside it
+func (c *Codec) Decode(scope string, cursor string) (map[string]ddbtypes.AttributeValue, error) {
+	encodedData, encodedSignature, found := strings.Cut(cursor, ".")
+
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encodedData)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+
+	if err != nil || !hmac.Equal(signature, c.sign(data)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var p payload
+
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// a cursor from another list (or another category, user...) is not valid here
+	if p.Scope != scope || len(p.Key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	if time.Now().Unix() > p.Expires {
+		return nil, ErrExpiredCursor
+	}
+
+	key := map[string]ddbtypes.AttributeValue{}
+
+	for name, value := range p.Key {
+		switch {
+		case value.S != nil:
+			key[name] = &ddbtypes.AttributeValueMemberS{Value: *value.S}
+		case value.N != nil:
+			key[name] = &ddbtypes.AttributeValueMemberN{Value: *value.N}
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return key, nil
+}
+
+func (c *Codec) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,110 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func testKey(id string) map[string]ddbtypes.AttributeValue {
+	return map[string]ddbtypes.AttributeValue{
+		"entityType": &ddbtypes.AttributeValueMemberS{Value: "coupon"},
+		"id":         &ddbtypes.AttributeValueMemberS{Value: id},
+	}
+}
+
+func encode(t *testing.T, codec *Codec, scope string, key map[string]ddbtypes.AttributeValue) string {
+	t.Helper()
+
+	cursor, err := codec.Encode(scope, key)
+
+	if err != nil || cursor == nil {
+		t.Fatalf("failed to encode cursor: %v", err)
+	}
+
+	return *cursor
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec := NewCodec([]byte("secret"), time.Hour)
+
+	key, err := codec.Decode("coupons", encode(t, codec, "coupons", testKey("coupon-1")))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if id := key["id"].(*ddbtypes.AttributeValueMemberS).Value; id != "coupon-1" {
+		t.Errorf("expected coupon-1, got %s", id)
+	}
+
+	// the last page has no cursor
+	if cursor, err := codec.Encode("coupons", nil); cursor != nil || err != nil {
+		t.Errorf("expected no cursor for an empty key, got %v, %v", cursor, err)
+	}
+}
+
+func TestCodecRejectsInvalidCursors(t *testing.T) {
+	codec := NewCodec([]byte("secret"), time.Hour)
+	cursor := encode(t, codec, "coupons", testKey("coupon-1"))
+
+	data, signature, _ := strings.Cut(cursor, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(data)
+
+	// jump to another key, keeping the original signature
+	tamperedPayload := strings.Replace(string(payload), "coupon-1", "coupon-9", 1)
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(tamperedPayload)) + "." + signature
+
+	expired := encode(t, NewCodec([]byte("secret"), -time.Minute), "coupons", testKey("coupon-1"))
+	otherKey := encode(t, NewCodec([]byte("another secret"), time.Hour), "coupons", testKey("coupon-1"))
+
+	tests := []struct {
+		name   string
+		scope  string
+		cursor string
+		want   error
+	}{
+		{"tampered payload", "coupons", tampered, ErrInvalidCursor},
+		{"signed with another key", "coupons", otherKey, ErrInvalidCursor},
+		{"expired", "coupons", expired, ErrExpiredCursor},
+		{"another scope", "category#food", cursor, ErrInvalidCursor},
+		{"not a cursor", "coupons", "garbage", ErrInvalidCursor},
+	}
+
+	for _, test := range tests {
+		key, err := codec.Decode(test.scope, test.cursor)
+
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got key %v and error %v", test.name, test.want, key, err)
+		}
+	}
+}
+
+func TestNewCodecFromEnv(t *testing.T) {
+	t.Setenv("CURSOR_SECRET", "")
+	t.Setenv("SECRET", "jwt-secret")
+
+	// the JWT secret is never used for the cursors
+	if _, err := NewCodecFromEnv(); !errors.Is(err, ErrMissingCursorSecret) {
+		t.Errorf("expected %v, got %v", ErrMissingCursorSecret, err)
+	}
+
+	t.Setenv("CURSOR_SECRET", "cursor-secret")
+
+	first, err := NewCodecFromEnv()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, _ := NewCodecFromEnv()
+
+	// another instance of the lambda accepts the cursor
+	if _, err := second.Decode("coupons", encode(t, first, "coupons", testKey("coupon-1"))); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
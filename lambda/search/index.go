@@ -0,0 +1,346 @@
+package search
+
+// In-process implementation of the SearchIndex: an inverted index of the words of the title and the
+// description of every coupon, kept in memory. The filters and the sorting are applied over the matches
+
+import (
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/types"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var _ types.SearchIndex = (*MemoryIndex)(nil)
+
+type MemoryIndex struct {
+	mu sync.RWMutex
+
+	coupons  map[string]types.Coupon
+	postings map[string]map[string]bool // word -> ids of the coupons with that word
+	terms    []string                   // the words of the postings in order, for finding the ones with a prefix
+	words    map[string][]string        // id -> words of the coupon, for removing it from the postings
+
+	cursors *pagination.Codec
+}
+
+func NewMemoryIndex(cursors *pagination.Codec) *MemoryIndex {
+	return &MemoryIndex{
+		coupons:  map[string]types.Coupon{},
+		postings: map[string]map[string]bool{},
+		words:    map[string][]string{},
+		cursors:  cursors,
+	}
+}
+
+// the new index is built aside, so the searches only wait for the swap
+func (i *MemoryIndex) Rebuild(ctx context.Context, coupons []types.Coupon) error {
+	fresh := NewMemoryIndex(i.cursors)
+	now := time.Now()
+
+	for _, coupon := range coupons {
+		if coupon.IsOnSale(now) {
+			fresh.add(coupon)
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.coupons = fresh.coupons
+	i.postings = fresh.postings
+	i.terms = fresh.terms
+	i.words = fresh.words
+
+	return nil
+}
+
+func (i *MemoryIndex) IndexCoupon(ctx context.Context, coupon types.Coupon) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(coupon.Id)
+
+	if coupon.IsOnSale(time.Now()) {
+		i.add(coupon)
+	}
+
+	return nil
+}
+
+func (i *MemoryIndex) RemoveCoupon(ctx context.Context, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+
+	return nil
+}
+
+// the caller must hold the lock
+func (i *MemoryIndex) add(coupon types.Coupon) {
+	words := tokenize(coupon.Title + " " + coupon.OfferDesc)
+
+	for _, word := range words {
+		if i.postings[word] == nil {
+			i.postings[word] = map[string]bool{}
+			i.terms = slices.Insert(i.terms, sort.SearchStrings(i.terms, word), word)
+		}
+
+		i.postings[word][coupon.Id] = true
+	}
+
+	i.coupons[coupon.Id] = coupon
+	i.words[coupon.Id] = words
+}
+
+// the caller must hold the lock
+func (i *MemoryIndex) remove(id string) {
+	for _, word := range i.words[id] {
+		delete(i.postings[word], id)
+
+		if len(i.postings[word]) == 0 {
+			delete(i.postings, word)
+
+			if position, found := slices.BinarySearch(i.terms, word); found {
+				i.terms = slices.Delete(i.terms, position, position+1)
+			}
+		}
+	}
+
+	delete(i.coupons, id)
+	delete(i.words, id)
+}
+
+func (i *MemoryIndex) SearchCoupons(ctx context.Context, query types.CouponSearch) (types.CouponRange, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	couponRange := types.CouponRange{
+		Coupons: []types.Coupon{},
+	}
+
+	scope, err := searchScope(query)
+
+	if err != nil {
+		return couponRange, err
+	}
+
+	now := time.Now()
+	results := []result{}
+
+	for id := range i.matches(tokenize(query.Text)) {
+		coupon := i.coupons[id]
+
+		// the coupons can stop being on sale after they were indexed
+		if coupon.IsOnSale(now) && matchesFilters(coupon, query, now) {
+			results = append(results, result{coupon: coupon, key: sortKey(coupon, query.Sort)})
+		}
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].before(results[b].key, results[b].coupon.Id)
+	})
+
+	start := 0
+
+	if query.Next != nil {
+		lastKey, err := i.cursors.Decode(scope, *query.Next)
+
+		if err != nil {
+			return couponRange, err
+		}
+
+		lastSort, lastId, err := cursorPosition(lastKey)
+
+		if err != nil {
+			return couponRange, err
+		}
+
+		// the position is exclusive, like the ExclusiveStartKey of DynamoDB
+		start = sort.Search(len(results), func(r int) bool {
+			return !results[r].before(lastSort, lastId) && !(results[r].key == lastSort && results[r].coupon.Id == lastId)
+		})
+	}
+
+	end := min(start+int(query.Limit), len(results))
+
+	for _, r := range results[start:end] {
+		couponRange.Coupons = append(couponRange.Coupons, r.coupon)
+	}
+
+	if end >= len(results) {
+		return couponRange, nil
+	}
+
+	last := results[end-1]
+
+	couponRange.Next, err = i.cursors.Encode(scope, map[string]ddbtypes.AttributeValue{
+		"sort": &ddbtypes.AttributeValueMemberN{Value: strconv.FormatFloat(last.key, 'g', -1, 64)},
+		"id":   &ddbtypes.AttributeValueMemberS{Value: last.coupon.Id},
+	})
+
+	if err != nil {
+		return types.CouponRange{Coupons: []types.Coupon{}}, err
+	}
+
+	return couponRange, nil
+}
+
+// ids of the coupons that have every word of the text. The words are matched by their beginning,
+// so the results can be shown while the client is still typing: the indexed words with a prefix are
+// next to each other in the sorted terms. An empty text matches every coupon
+func (i *MemoryIndex) matches(words []string) map[string]bool {
+	if len(words) == 0 {
+		ids := make(map[string]bool, len(i.coupons))
+
+		for id := range i.coupons {
+			ids[id] = true
+		}
+
+		return ids
+	}
+
+	var ids map[string]bool
+
+	for _, word := range words {
+		wordIds := map[string]bool{}
+
+		for _, indexed := range i.termsWithPrefix(word) {
+			for id := range i.postings[indexed] {
+				if ids == nil || ids[id] {
+					wordIds[id] = true
+				}
+			}
+		}
+
+		ids = wordIds
+
+		if len(ids) == 0 {
+			break
+		}
+	}
+
+	return ids
+}
+
+// the caller must hold the lock
+func (i *MemoryIndex) termsWithPrefix(prefix string) []string {
+	start := sort.SearchStrings(i.terms, prefix)
+	end := start
+
+	for end < len(i.terms) && strings.HasPrefix(i.terms[end], prefix) {
+		end++
+	}
+
+	return i.terms[start:end]
+}
+
+func matchesFilters(coupon types.Coupon, query types.CouponSearch, now time.Time) bool {
+	if query.Category != "" && coupon.Category != query.Category {
+		return false
+	}
+
+	if query.EnterpriseId != "" && coupon.EnterpriseId != query.EnterpriseId {
+		return false
+	}
+
+	if query.MinPrice != nil && coupon.OfferPrice < *query.MinPrice {
+		return false
+	}
+
+	if query.MaxPrice != nil && coupon.OfferPrice > *query.MaxPrice {
+		return false
+	}
+
+	if query.MinDiscount != nil && coupon.DiscountPercent() < float64(*query.MinDiscount) {
+		return false
+	}
+
+	if query.ExpiringWithin != nil && coupon.ValidUntil.After(now.Add(*query.ExpiringWithin)) {
+		return false
+	}
+
+	return true
+}
+
+type result struct {
+	coupon types.Coupon
+	key    float64 // ascending, see sortKey
+}
+
+// the results go in ascending order of their key, and then of their id
+func (r result) before(key float64, id string) bool {
+	if r.key != key {
+		return r.key < key
+	}
+
+	return r.coupon.Id < id
+}
+
+// the orders that go from the highest value are negated, so every key is sorted in ascending order.
+// The dates are in milliseconds, so they fit in a float64 without losing precision
+func sortKey(coupon types.Coupon, order string) float64 {
+	switch order {
+	case types.SearchSortDiscount:
+		return -coupon.DiscountPercent()
+	case types.SearchSortPrice:
+		return float64(coupon.OfferPrice)
+	case types.SearchSortExpiry:
+		return float64(coupon.ValidUntil.UnixMilli())
+	default:
+		return -float64(createdAt(coupon).UnixMilli())
+	}
+}
+
+// the coupons created before the date was stored were put on sale when they were created
+func createdAt(coupon types.Coupon) time.Time {
+	if coupon.CreatedAt.IsZero() {
+		return coupon.ValidFrom
+	}
+
+	return coupon.CreatedAt
+}
+
+func cursorPosition(key map[string]ddbtypes.AttributeValue) (float64, string, error) {
+	sortValue, okSort := key["sort"].(*ddbtypes.AttributeValueMemberN)
+	id, okId := key["id"].(*ddbtypes.AttributeValueMemberS)
+
+	if !okSort || !okId {
+		return 0, "", pagination.ErrInvalidCursor
+	}
+
+	position, err := strconv.ParseFloat(sortValue.Value, 64)
+
+	if err != nil {
+		return 0, "", pagination.ErrInvalidCursor
+	}
+
+	return position, id.Value, nil
+}
+
+// a cursor is only valid for the same text, filters and order it was created for
+func searchScope(query types.CouponSearch) (string, error) {
+	query.Next = nil
+	query.Limit = 0
+
+	data, err := json.Marshal(query)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal search query, %v", err)
+	}
+
+	hash := sha256.Sum256(data)
+
+	return "search#" + hex.EncodeToString(hash[:8]), nil
+}
@@ -0,0 +1,221 @@
+package search
+
+import (
+	"OriD19/webdev2/pagination"
+	"OriD19/webdev2/types"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testCoupons(now time.Time) []types.Coupon {
+	coupon := func(id string, title string, regular float32, offer float32, from time.Duration, until time.Duration) types.Coupon {
+		return types.Coupon{
+			Id:           id,
+			Title:        title,
+			OfferDesc:    "descuento en " + title,
+			RegularPrice: regular,
+			OfferPrice:   offer,
+			ValidFrom:    now.Add(from),
+			ValidUntil:   now.Add(until),
+			CouponState:  types.CouponStateActive,
+			EnterpriseId: "enterprise-1",
+			Category:     "food",
+		}
+	}
+
+	coupons := []types.Coupon{
+		coupon("pizza", "Pizza familiar", 20, 10, -3*time.Hour, 48*time.Hour),     // 50%, expires in 2 days
+		coupon("cafe", "Café americano", 4, 3, -2*time.Hour, 10*24*time.Hour),     // 25%
+		coupon("pizza-2", "Pizza personal", 10, 9, -1*time.Hour, 30*24*time.Hour), // 10%
+	}
+
+	// not on sale, never returned
+	inactive := coupon("pizza-3", "Pizza gigante", 30, 10, -time.Hour, 24*time.Hour)
+	inactive.CouponState = types.CouponStateInactive
+
+	other := coupon("zapatos", "Zapatos", 50, 25, -time.Hour, 24*time.Hour)
+	other.Category = "clothes"
+	other.EnterpriseId = "enterprise-2"
+
+	return append(coupons, inactive, other)
+}
+
+func ids(coupons []types.Coupon) []string {
+	result := []string{}
+
+	for _, coupon := range coupons {
+		result = append(result, coupon.Id)
+	}
+
+	return result
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryIndex(pagination.NewCodec([]byte("secret"), time.Hour))
+	index.Rebuild(ctx, testCoupons(time.Now()))
+
+	minDiscount := float32(20)
+	maxPrice := float32(5)
+	within := 3 * 24 * time.Hour
+
+	tests := []struct {
+		name  string
+		query types.CouponSearch
+		want  []string
+	}{
+		{"every coupon, newest first", types.CouponSearch{}, []string{"pizza-2", "zapatos", "cafe", "pizza"}},
+		{"words by prefix", types.CouponSearch{Text: "piz"}, []string{"pizza-2", "pizza"}},
+		{"every word must match", types.CouponSearch{Text: "pizza familiar"}, []string{"pizza"}},
+		{"without accents", types.CouponSearch{Text: "cafe"}, []string{"cafe"}},
+		{"no matches", types.CouponSearch{Text: "hamburguesa"}, []string{}},
+		{"category", types.CouponSearch{Category: "clothes"}, []string{"zapatos"}},
+		{"enterprise", types.CouponSearch{EnterpriseId: "enterprise-2"}, []string{"zapatos"}},
+		{"maximum price", types.CouponSearch{MaxPrice: &maxPrice}, []string{"cafe"}},
+		{"minimum discount", types.CouponSearch{MinDiscount: &minDiscount, Sort: types.SearchSortDiscount}, []string{"pizza", "zapatos", "cafe"}},
+		{"expiring soon", types.CouponSearch{ExpiringWithin: &within, Sort: types.SearchSortExpiry}, []string{"zapatos", "pizza"}},
+		{"by price", types.CouponSearch{Text: "pizza", Sort: types.SearchSortPrice}, []string{"pizza-2", "pizza"}},
+	}
+
+	for _, test := range tests {
+		test.query.Limit = 10
+
+		result, err := index.SearchCoupons(ctx, test.query)
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if got := ids(result.Coupons); !equal(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestMemoryIndexPagination(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryIndex(pagination.NewCodec([]byte("secret"), time.Hour))
+	index.Rebuild(ctx, testCoupons(time.Now()))
+
+	query := types.CouponSearch{Sort: types.SearchSortPrice, Limit: 3}
+	got := []string{}
+
+	for {
+		result, err := index.SearchCoupons(ctx, query)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got = append(got, ids(result.Coupons)...)
+
+		if result.Next == nil {
+			break
+		}
+
+		query.Next = result.Next
+	}
+
+	want := []string{"cafe", "pizza-2", "pizza", "zapatos"}
+
+	if !equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// the cursor can't be used with other filters
+	_, err := index.SearchCoupons(ctx, types.CouponSearch{Sort: types.SearchSortNewest, Limit: 3, Next: query.Next})
+
+	if !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("expected an invalid cursor error, got %v", err)
+	}
+}
+
+func TestMemoryIndexUpdates(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryIndex(pagination.NewCodec([]byte("secret"), time.Hour))
+	coupons := testCoupons(time.Now())
+	index.Rebuild(ctx, coupons)
+
+	// renamed: the old words no longer find it
+	renamed := coupons[0]
+	renamed.Title = "Hamburguesa doble"
+	renamed.OfferDesc = ""
+	index.IndexCoupon(ctx, renamed)
+
+	result, _ := index.SearchCoupons(ctx, types.CouponSearch{Text: "familiar", Limit: 10})
+
+	if len(result.Coupons) != 0 {
+		t.Errorf("expected no results for the old title, got %v", ids(result.Coupons))
+	}
+
+	result, _ = index.SearchCoupons(ctx, types.CouponSearch{Text: "hamburguesa", Limit: 10})
+
+	if got := ids(result.Coupons); !equal(got, []string{"pizza"}) {
+		t.Errorf("expected the renamed coupon, got %v", got)
+	}
+
+	// the words of no coupon are gone from the terms too
+	for _, term := range index.termsWithPrefix("fam") {
+		t.Errorf("expected no terms for the old title, got %q", term)
+	}
+
+	// deactivated coupons are removed
+	renamed.CouponState = types.CouponStateInactive
+	index.IndexCoupon(ctx, renamed)
+
+	result, _ = index.SearchCoupons(ctx, types.CouponSearch{Text: "hamburguesa", Limit: 10})
+
+	if len(result.Coupons) != 0 {
+		t.Errorf("expected the inactive coupon to be removed, got %v", ids(result.Coupons))
+	}
+}
+
+func TestMemoryIndexNewestByCreation(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryIndex(pagination.NewCodec([]byte("secret"), time.Hour))
+	now := time.Now()
+
+	// created first, but put on sale later than the other one
+	scheduled := testCoupons(now)[0]
+	scheduled.CreatedAt = now.Add(-72 * time.Hour)
+	scheduled.ValidFrom = now.Add(-24 * time.Hour)
+
+	created := testCoupons(now)[1]
+	created.CreatedAt = now.Add(-48 * time.Hour)
+	created.ValidFrom = now.Add(-48 * time.Hour)
+
+	// created before the date was stored, so it goes by the start of the sale
+	old := testCoupons(now)[2]
+	old.ValidFrom = now.Add(-96 * time.Hour)
+
+	index.Rebuild(ctx, []types.Coupon{scheduled, created, old})
+
+	result, err := index.SearchCoupons(ctx, types.CouponSearch{Sort: types.SearchSortNewest, Limit: 10})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"cafe", "pizza", "pizza-2"}
+
+	if got := ids(result.Coupons); !equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,33 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// letters with accents are searched without them, so "cafe" finds "café" and the other way around
+var accentFolding = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u",
+)
+
+// split a text in lower case words without accents. Repeated words are only returned once
+func tokenize(text string) []string {
+	folded := accentFolding.Replace(strings.ToLower(text))
+
+	words := strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := map[string]bool{}
+	tokens := make([]string, 0, len(words))
+
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+
+	return tokens
+}
@@ -6,16 +6,26 @@ import "context"
 	When a coupon is bought, it is associated with a user ID.
 	So when we query data again, we know that said coupon is already taken.
 
-	Redeem operations just modify the "redeemed" field inside the database
+	Redeem operations just modify the "redeemed" field inside the database (and who redeemed it).
+	They never touch the inventory of the parent coupon
 */
 
 type CouponStore interface {
-	GetAllCoupons(context.Context, *string) (CouponRange, error)
-	GetAllCouponsFromCategory(context.Context, string) (CouponRange, error)
+	// list methods receive the pagination token (nil for the first page) and the page size
+	GetAllCoupons(context.Context, *string, int32) (CouponRange, error)
+	GetAllCouponsFromCategory(context.Context, string, *string, int32) (CouponRange, error)
 	GetCoupon(context.Context, string) (Coupon, error)
 	PutCoupon(context.Context, Coupon) error
-	RedeemCoupon(context.Context, string) error
+	// moves the coupon to transition.To, only if it is still in transition.From. Returns the updated coupon
+	UpdateCouponState(context.Context, string, CouponTransition) (Coupon, error)
+	// patches the editable fields of a coupon that is pending, active or inactive. Returns the updated coupon
+	UpdateCoupon(context.Context, string, CouponUpdate) (Coupon, error)
+	RedeemCoupon(context.Context, string, Employee) error
 	BuyCoupon(context.Context, string, string) (GeneratedOffer, error)
-	GetUserOffers(context.Context, string) (OfferRange, error)
+	GetUserOffers(context.Context, string, OfferQuery) (OfferRange, error)
 	GetGeneratedOffer(context.Context, string) (GeneratedOffer, error)
+
+	// all the coupons (in any state) and all the sold offers of an enterprise
+	GetEnterpriseCoupons(context.Context, string, *string, int32) (CouponRange, error)
+	GetEnterpriseOffers(context.Context, string, *string, int32) (OfferRange, error)
 }
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors returned by the stores (and the domain), so the upper layers can tell apart the expected failures.
+// Wrap them with more context, for example: fmt.Errorf("coupon %w", ErrNotFound) -> "coupon not found"
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrSoldOut         = errors.New("coupon is sold out")
+	ErrPurchaseLimit   = errors.New("the client already bought the maximum amount of this coupon")
+	ErrConflict        = errors.New("the item was modified concurrently, try again")
+	ErrExpired         = errors.New("offer is expired")
+	ErrAlreadyRedeemed = errors.New("offer is already redeemed")
+	ErrValidation      = errors.New("validation failed")
+	ErrInvalidState    = errors.New("operation not allowed in the current state")
+	ErrForbidden       = errors.New("not authorized for this action")
+	ErrLoginLocked     = errors.New("too many failed login attempts, try again later")
+)
+
+// a validation error with the problems of each field. It matches ErrValidation with errors.Is
+type ValidationErrors []FieldError
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+
+	for i, fieldError := range v {
+		messages[i] = fieldError.Field + ": " + fieldError.Message
+	}
+
+	return ErrValidation.Error() + ": " + strings.Join(messages, ", ")
+}
+
+func (v ValidationErrors) Unwrap() error {
+	return ErrValidation
+}
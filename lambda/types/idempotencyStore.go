@@ -0,0 +1,25 @@
+package types
+
+import "context"
+
+/*
+	Stores the first response sent for an Idempotency-Key, so retried requests
+	(for example, after a timeout in the mobile app) don't buy the same coupon twice.
+
+	Keys are scoped to the caller: the record key is <caller>#<Idempotency-Key>
+*/
+
+type IdempotencyStore interface {
+	// creates the record only if the key is not in use (or its window already expired).
+	// Returns ErrConflict if the key was already reserved
+	ReserveIdempotencyKey(context.Context, IdempotencyRecord) error
+
+	// returns ErrNotFound if the key does not exist or its window already expired
+	GetIdempotencyRecord(context.Context, string) (IdempotencyRecord, error)
+
+	// stores the response of a reserved key
+	CompleteIdempotencyKey(context.Context, IdempotencyRecord) error
+
+	// deletes a reserved key, so the request can be retried with it
+	ReleaseIdempotencyKey(context.Context, string) error
+}
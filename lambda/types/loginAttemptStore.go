@@ -0,0 +1,27 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Failed login attempts, counted for each user and for each source IP.
+
+	The counters are kept until the given expiration, which is extended with every new attempt,
+	so they start again from zero after a while without failures
+*/
+
+type LoginAttemptStore interface {
+	// adds an attempt to the counter of the key, in a single update, and returns the updated counter.
+	// Returns ErrLoginLocked (and the counter, with its LockedUntil) without counting it while the key is locked
+	RecordLoginAttempt(context.Context, string, time.Time, time.Time) (LoginAttempts, error)
+
+	// locks the key until the given time, unless a later attempt than the given failures locked it already
+	LockLogin(context.Context, string, int, time.Time) error
+
+	// takes back an attempt that didn't fail. The failures counted by a lockout are never taken back
+	ReleaseLoginAttempt(context.Context, string) error
+
+	ClearLoginAttempts(context.Context, string) error
+}
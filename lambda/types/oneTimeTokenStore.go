@@ -0,0 +1,23 @@
+package types
+
+import "context"
+
+/*
+	Single use tokens sent by email, like the password reset links.
+
+	Only the hash of the token is saved, and the purpose is part of the key,
+	so a token created for one flow can't be used in another one
+*/
+
+const (
+	PurposePasswordReset     = "passwordReset"
+	PurposeEmailVerification = "emailVerification"
+)
+
+type OneTimeTokenStore interface {
+	PutOneTimeToken(context.Context, OneTimeToken) error
+
+	// deletes the token (purpose, hash) and returns it, so it can only be used once.
+	// Returns ErrNotFound if it does not exist or is already expired
+	ConsumeOneTimeToken(context.Context, string, string) (OneTimeToken, error)
+}
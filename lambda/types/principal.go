@@ -0,0 +1,65 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// roles inside the JWT tokens
+const (
+	RoleClient        = "client"
+	RoleEmployee      = "employee"
+	RoleEnterprise    = "enterprise"
+	RoleAdministrator = "administrator"
+)
+
+var ErrInvalidToken = errors.New("invalid JWT token")
+
+// the authenticated caller of a request, taken from its token
+type Principal struct {
+	Username string
+	Role     string
+	// only for enterprises and employees
+	EnterpriseId string
+
+	// used for revoking the token
+	TokenId   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type principalKey struct{}
+
+func ContextWithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// returns false for the public routes, where no token was sent
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// validate the token and read the caller from its claims
+func ParsePrincipal(tokenString string) (Principal, error) {
+	claims, err := ParseToken(tokenString)
+
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	principal := Principal{
+		Username:     claims.Subject,
+		Role:         claims.Role,
+		EnterpriseId: claims.EnterpriseId,
+		TokenId:      claims.ID,
+	}
+
+	// ParseToken requires both, exp with WithExpirationRequired and iat with its own check
+	principal.IssuedAt = claims.IssuedAt.Time
+	principal.ExpiresAt = claims.ExpiresAt.Time
+
+	return principal, nil
+}
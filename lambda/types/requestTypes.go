@@ -20,6 +20,15 @@ type RegisterClientRequest struct {
 	DUI         string `json:"dui" validator:"required"`
 }
 
+// only the fields sent in the request are updated. A new email must be verified again
+type UpdateClientProfileRequest struct {
+	FirstName   *string `json:"firstName,omitempty" validate:"omitempty,min=1"`
+	LastName    *string `json:"lastName,omitempty" validate:"omitempty,min=1"`
+	Address     *string `json:"address,omitempty"`
+	PhoneNumber *string `json:"phoneNumber,omitempty"`
+	Email       *string `json:"email,omitempty" validate:"omitempty,email"`
+}
+
 type RegisterEmployeeRequest struct {
 	Username    string `json:"username" validate:"required"`
 	Email       string `json:"email" validate:"required,email"`
@@ -28,15 +37,76 @@ type RegisterEmployeeRequest struct {
 	LastName    string `json:"lastName" validate:"required"`
 	PhoneNumber string `json:"phoneNumber,omitempty"`
 	DUI         string `json:"dui" validator:"required"`
+	// only used by administrators. Employees are always registered in the enterprise of the caller
+	EnterpriseId string `json:"enterpriseId,omitempty"`
+}
+
+type RegisterAdministratorRequest struct {
+	Username  string `json:"username" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,min=8"`
+	FirstName string `json:"firstName" validate:"required"`
+	LastName  string `json:"lastName" validate:"required"`
+}
+
+// used by the administrators for unlocking the accounts blocked after many failed logins
+type UnlockUserRequest struct {
+	UserType string `json:"userType" validate:"required,oneof=client employee enterprise administrator"`
+}
+
+// used by the administrators for disabling and enabling accounts
+type ModerateUserRequest struct {
+	UserType string `json:"userType" validate:"required,oneof=client employee"`
+	Reason   string `json:"reason,omitempty" validate:"max=500"`
+}
+
+type RegisterEnterpriseRequest struct {
+	Username            string `json:"username" validate:"required,max=100"`
+	Email               string `json:"email" validate:"required,email"`
+	Password            string `json:"password" validate:"required,min=8"`
+	EnterpriseName      string `json:"enterpriseName" validate:"required"`
+	ScheduleDescription string `json:"scheduleDescription,omitempty"`
+	Location            string `json:"location" validate:"required"`
+	PhoneNumber         string `json:"phoneNumber,omitempty"`
+	Category            string `json:"category" validate:"required"`
+}
+
+// only the fields sent in the request are updated
+type UpdateEnterpriseRequest struct {
+	Email               *string `json:"email,omitempty" validate:"omitempty,email"`
+	EnterpriseName      *string `json:"enterpriseName,omitempty" validate:"omitempty,min=1"`
+	ScheduleDescription *string `json:"scheduleDescription,omitempty"`
+	Location            *string `json:"location,omitempty" validate:"omitempty,min=1"`
+	PhoneNumber         *string `json:"phoneNumber,omitempty"`
+	Category            *string `json:"category,omitempty" validate:"omitempty,min=1"`
 }
 
 type CreateNewCouponRequest struct {
 	Title            string     `json:"title" validate:"required"`
 	RegularPrice     float32    `json:"regularPrice" validate:"required,gte=0"`
 	OfferPrice       float32    `json:"offerPrice" validate:"required,gte=0"`
-	AvailableCoupons int        `json:"availableCoupons" validate:"required,gte=1"`
+	AvailableCoupons int        `json:"availableCoupons" validate:"required,gte=-1"` // -1 for unlimited coupons
 	ExpiresAt        CustomTime `json:"expiresAt" validate:"required"`
 	OfferDesc        string     `json:"offerDesc" validate:"required"`
+	MaxPerClient     int        `json:"maxPerClient,omitempty" validate:"gte=0"` // 0 or missing for no limit
+	// optional, for scheduling the launch of the coupon. By default it starts as soon as it is approved
+	ValidFrom *CustomTime `json:"validFrom,omitempty"`
+	// only used by administrators. Employees always create coupons for their own enterprise
+	EnterpriseId string `json:"enterpriseId,omitempty"`
+}
+
+// only the fields sent in the request are updated
+type UpdateCouponRequest struct {
+	Title        *string     `json:"title,omitempty" validate:"omitempty,min=1,max=100"`
+	RegularPrice *float32    `json:"regularPrice,omitempty" validate:"omitempty,gte=0"`
+	OfferPrice   *float32    `json:"offerPrice,omitempty" validate:"omitempty,gte=0"`
+	ExpiresAt    *CustomTime `json:"expiresAt,omitempty"`
+	OfferDesc    *string     `json:"offerDesc,omitempty" validate:"omitempty,min=1"`
+	MaxPerClient *int        `json:"maxPerClient,omitempty" validate:"omitempty,gte=0"` // 0 removes the limit
+}
+
+type RejectCouponRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
 }
 
 type LoginRequest struct {
@@ -44,6 +114,29 @@ type LoginRequest struct {
 	Password string `json:"password" validator:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// the refresh token is optional, but without it the session can still be refreshed until it expires
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// the reset link is sent to the email of the account
+type ForgotPasswordRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 func (c *CustomTime) UnmarshalJSON(data []byte) error {
 	// parse the date in a YYYY-MM-DD format
 	var timeString string
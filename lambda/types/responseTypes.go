@@ -4,3 +4,13 @@ type CouponResponseType struct {
 	Coupon
 	EnterpriseDetails Enterprise `json:"enterprise"`
 }
+
+type EnterpriseRange struct {
+	Enterprises []Enterprise `json:"enterprises"`
+	Next        *string      `json:"next"`
+}
+
+type EmployeeRange struct {
+	Employees []Employee `json:"employees"`
+	Next      *string    `json:"next"`
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Full-text search over the coupons on sale, with filters and sorting.
+
+	The index only keeps the coupons the clients can buy (see Coupon.IsOnSale).
+	It is fed by the coupons domain: rebuilt from the store from time to time, and
+	updated every time a coupon changes in the same process
+*/
+
+// orders of the search results. Ties are broken by the id of the coupon
+const (
+	SearchSortNewest   = "newest"   // latest CreatedAt first (default)
+	SearchSortDiscount = "discount" // highest discount percentage first
+	SearchSortPrice    = "price"    // lowest offer price first
+	SearchSortExpiry   = "expiry"   // the ones that expire sooner first
+)
+
+type CouponSearch struct {
+	Text         string // words of the title or the description. Every word must match
+	Category     string
+	EnterpriseId string
+
+	// filters over the offer price and the discount percentage, nil when they are not used
+	MinPrice    *float32
+	MaxPrice    *float32
+	MinDiscount *float32
+
+	ExpiringWithin *time.Duration // only the coupons that expire before now + ExpiringWithin
+
+	Sort  string  // one of the SearchSort constants
+	Next  *string // pagination token
+	Limit int32
+}
+
+type SearchIndex interface {
+	// replaces every coupon of the index
+	Rebuild(context.Context, []Coupon) error
+
+	// adds or replaces a coupon. The coupons that are not on sale are removed instead
+	IndexCoupon(context.Context, Coupon) error
+	RemoveCoupon(context.Context, string) error
+
+	SearchCoupons(context.Context, CouponSearch) (CouponRange, error)
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Refresh tokens and revoked access tokens.
+
+	Access tokens can be revoked one by one (by their jti, until they expire),
+	or all the sessions of a user at once: every token issued before that moment is rejected
+*/
+
+type SessionStore interface {
+	PutRefreshToken(context.Context, RefreshToken) error
+
+	// deletes the refresh token and returns it, so it can only be used once.
+	// Returns ErrNotFound if it does not exist or is already expired
+	ConsumeRefreshToken(context.Context, string) (RefreshToken, error)
+
+	// adds the jti to the deny-list until the given expiration
+	RevokeToken(context.Context, string, time.Time) error
+
+	// revokes every token of the user (role, username) issued before the given time
+	RevokeAllSessions(context.Context, string, string, time.Time) error
+
+	// checks the jti of the principal and the sessions of its user. An empty TokenId only checks the user
+	IsSessionRevoked(context.Context, Principal) (bool, error)
+}
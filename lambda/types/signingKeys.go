@@ -0,0 +1,225 @@
+package types
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+	Asymmetric keys for the access tokens.
+
+	JWT_SIGNING_KEY has the PEM private key (RSA or Ed25519) and JWT_SIGNING_KEY_ID its kid.
+	Only the login lambda has it, the rest of the lambdas verify the tokens with the public keys.
+
+	JWT_PUBLIC_KEYS is a JSON object of kid -> PEM public key. During a rotation it has the old keys
+	and the new one, so the tokens signed with any of them are accepted. The public key of the
+	signing key is always accepted too.
+*/
+
+// a key that is not RSA or Ed25519
+var ErrUnsupportedKey = errors.New("unsupported signing key, only RSA and Ed25519 keys are accepted")
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    crypto.PrivateKey
+}
+
+type verificationKey struct {
+	id     string
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// public key in the JWK format (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA keys
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// the key used for signing, or nil if JWT_SIGNING_KEY is not set (the tokens are signed with the SECRET)
+func currentSigningKey() (*signingKey, error) {
+	encoded := os.Getenv("JWT_SIGNING_KEY")
+
+	if encoded == "" {
+		return nil, nil
+	}
+
+	id := os.Getenv("JWT_SIGNING_KEY_ID")
+
+	if id == "" {
+		return nil, fmt.Errorf("JWT_SIGNING_KEY_ID must be set alongside JWT_SIGNING_KEY")
+	}
+
+	block, _ := pem.Decode([]byte(encoded))
+
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode JWT_SIGNING_KEY, it must be a PEM key")
+	}
+
+	var key crypto.PrivateKey
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT_SIGNING_KEY, %v", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{id: id, method: jwt.SigningMethodRS256, key: key}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{id: id, method: jwt.SigningMethodEdDSA, key: key}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// every key that can verify a token, by kid
+func verificationKeys() (map[string]verificationKey, error) {
+	keys := map[string]verificationKey{}
+
+	if encoded := os.Getenv("JWT_PUBLIC_KEYS"); encoded != "" {
+		var pemKeys map[string]string
+
+		err := json.Unmarshal([]byte(encoded), &pemKeys)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT_PUBLIC_KEYS, it must be a JSON object of kid -> PEM key: %v", err)
+		}
+
+		for id, pemKey := range pemKeys {
+			key, err := parsePublicKey(id, pemKey)
+
+			if err != nil {
+				return nil, err
+			}
+
+			keys[id] = key
+		}
+	}
+
+	signing, err := currentSigningKey()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if signing != nil {
+		keys[signing.id] = verificationKey{
+			id:     signing.id,
+			method: signing.method,
+			key:    signing.key.(crypto.Signer).Public(),
+		}
+	}
+
+	return keys, nil
+}
+
+func parsePublicKey(id string, pemKey string) (verificationKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+
+	if block == nil {
+		return verificationKey{}, fmt.Errorf("failed to decode the public key %s, it must be a PEM key", id)
+	}
+
+	var key crypto.PublicKey
+	var err error
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return verificationKey{}, fmt.Errorf("failed to parse the public key %s, %v", id, err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return verificationKey{id: id, method: jwt.SigningMethodRS256, key: key}, nil
+	case ed25519.PublicKey:
+		return verificationKey{id: id, method: jwt.SigningMethodEdDSA, key: key}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("public key %s: %w", id, ErrUnsupportedKey)
+	}
+}
+
+// the public keys of the API, so other services can verify the tokens without calling it
+func PublicKeySet() (JSONWebKeySet, error) {
+	keys, err := verificationKeys()
+
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+
+	set := JSONWebKeySet{
+		Keys: []JSONWebKey{},
+	}
+
+	for _, key := range keys {
+		set.Keys = append(set.Keys, key.jsonWebKey())
+	}
+
+	// same order on every call
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyId < set.Keys[j].KeyId
+	})
+
+	return set, nil
+}
+
+func (k verificationKey) jsonWebKey() JSONWebKey {
+	jwk := JSONWebKey{
+		KeyId:     k.id,
+		Use:       "sig",
+		Algorithm: k.method.Alg(),
+	}
+
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.Modulus = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	}
+
+	return jwk
+}
@@ -0,0 +1,264 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// JWT access tokens of the API, signed with the asymmetric key of JWT_SIGNING_KEY (see signingKeys.go).
+// Without it, the tokens are signed with HS256 and the SECRET variable, like the first versions of the API.
+// Once the asymmetric keys are configured, HS256 tokens are rejected, unless JWT_HS256_UNTIL (an RFC 3339 date)
+// is still in the future: a time-boxed migration for the tokens signed before the keys were deployed.
+// The issuer, audience and clock skew tolerance can be changed with JWT_ISSUER, JWT_AUDIENCE and JWT_LEEWAY
+
+var ErrMissingSecret = errors.New("the JWT secret is not configured")
+
+// an HS256 token when only the asymmetric keys are accepted
+var errHS256Disabled = errors.New("HS256 tokens are no longer accepted, the API uses asymmetric keys")
+
+const (
+	defaultIssuer   = "la-cuponera"
+	defaultAudience = "la-cuponera-api"
+	defaultLeeway   = 30 * time.Second
+
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// the username goes in the "sub" claim
+type TokenClaims struct {
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role"`
+	EnterpriseId string `json:"enterpriseId,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// access tokens are short lived, the sessions are extended with the refresh tokens
+func CreateAccessToken(principal Principal, email string) (string, error) {
+	return createToken(principal.Username, email, principal.Role, principal.EnterpriseId, AccessTokenTTL())
+}
+
+// how long an access token is valid. Configurable with ACCESS_TOKEN_TTL (for example, "15m")
+func AccessTokenTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+
+	if err != nil || ttl <= 0 {
+		return defaultAccessTokenTTL
+	}
+
+	return ttl
+}
+
+// how long a session can be extended without logging in again. Configurable with REFRESH_TOKEN_TTL (for example, "168h")
+func RefreshTokenTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_TTL"))
+
+	if err != nil || ttl <= 0 {
+		return defaultRefreshTokenTTL
+	}
+
+	return ttl
+}
+
+func createToken(username string, email string, role string, enterpriseId string, validFor time.Duration) (string, error) {
+	signing, err := currentSigningKey()
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := TokenClaims{
+		Email:        email,
+		Role:         role,
+		EnterpriseId: enterpriseId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			Issuer:    jwtIssuer(),
+			Audience:  jwt.ClaimStrings{jwtAudience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(validFor)),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	var tokenString string
+
+	if signing != nil {
+		token := jwt.NewWithClaims(signing.method, claims)
+		token.Header["kid"] = signing.id
+
+		tokenString, err = token.SignedString(signing.key)
+	} else {
+		tokenString, err = signWithSecret(claims)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// fallback for the deployments without asymmetric keys
+func signWithSecret(claims TokenClaims) (string, error) {
+	secret, err := jwtSecret()
+
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+func ExtractTokenFromHeaders(headers map[string]string) string {
+	authHeader, ok := headers["Authorization"]
+
+	if !ok {
+		return ""
+	}
+
+	splitToken := strings.Split(authHeader, "Bearer ")
+
+	if len(splitToken) != 2 {
+		return ""
+	}
+
+	return splitToken[1]
+}
+
+// validate the signature and the registered claims of the token. The tokens with a kid must be signed
+// with that key (RS256 or EdDSA), the ones without it are only accepted with HS256 when the SECRET is set,
+// and there are no asymmetric keys (or the migration of JWT_HS256_UNTIL is still going on)
+func ParseToken(tokenString string) (*TokenClaims, error) {
+	keys, err := verificationKeys()
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret, secretErr := jwtSecret()
+
+	if len(keys) == 0 && secretErr != nil {
+		return nil, secretErr
+	}
+
+	claims := &TokenClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		if kid == "" {
+			if t.Method != jwt.SigningMethodHS256 || secretErr != nil {
+				return nil, fmt.Errorf("the JWT token has no key id")
+			}
+
+			if len(keys) > 0 && !hs256MigrationActive() {
+				return nil, errHS256Disabled
+			}
+
+			return secret, nil
+		}
+
+		key, ok := keys[kid]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %s", kid)
+		}
+
+		// the algorithm of the header must be the one of the key
+		if t.Method != key.method {
+			return nil, fmt.Errorf("the key %s can't verify %s tokens", kid, t.Method.Alg())
+		}
+
+		return key.key, nil
+	},
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+			jwt.SigningMethodHS256.Alg(),
+		}),
+		jwt.WithIssuer(jwtIssuer()),
+		jwt.WithAudience(jwtAudience()),
+		jwt.WithLeeway(jwtLeeway()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT token: %w", err)
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid JWT token")
+	}
+
+	if claims.Subject == "" || claims.Role == "" {
+		return nil, fmt.Errorf("the JWT token has no subject or role")
+	}
+
+	// WithIssuedAt only validates the claim when it is there. It is needed for revoking the sessions
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("the JWT token has no issue date")
+	}
+
+	return claims, nil
+}
+
+// the secret is read on every call, so an empty one can never be used for signing or validating
+func jwtSecret() ([]byte, error) {
+	secret := os.Getenv("SECRET")
+
+	if secret == "" {
+		return nil, ErrMissingSecret
+	}
+
+	return []byte(secret), nil
+}
+
+// JWT_HS256_UNTIL is the end of the migration from HS256 to the asymmetric keys.
+// It must be a valid date, so a typo never leaves HS256 enabled forever
+func hs256MigrationActive() bool {
+	until, err := time.Parse(time.RFC3339, os.Getenv("JWT_HS256_UNTIL"))
+
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Before(until)
+}
+
+func jwtIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+
+	return defaultIssuer
+}
+
+func jwtAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+
+	return defaultAudience
+}
+
+// tolerance for the clock differences between the servers, like "30s"
+func jwtLeeway() time.Duration {
+	leeway, err := time.ParseDuration(os.Getenv("JWT_LEEWAY"))
+
+	if err != nil || leeway < 0 {
+		return defaultLeeway
+	}
+
+	return leeway
+}
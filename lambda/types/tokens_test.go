@@ -0,0 +1,434 @@
+package types
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func validClaims(now time.Time) TokenClaims {
+	return TokenClaims{
+		Email: "client@example.com",
+		Role:  RoleClient,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "client-1",
+			Issuer:    defaultIssuer,
+			Audience:  jwt.ClaimStrings{defaultAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "token-1",
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+
+	tokenString, err := jwt.NewWithClaims(method, claims).SignedString(key)
+
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return tokenString
+}
+
+// replace the role inside the payload, keeping the original signature
+func tamperPayload(t *testing.T, tokenString string) string {
+	t.Helper()
+
+	parts := strings.Split(tokenString, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+
+	tampered := strings.Replace(string(payload), `"role":"client"`, `"role":"administrator"`, 1)
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(tampered))
+
+	return strings.Join(parts, ".")
+}
+
+func TestParseToken(t *testing.T) {
+	t.Setenv("SECRET", testSecret)
+	t.Setenv("JWT_LEEWAY", "30s")
+
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{
+			name: "valid token",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(now))
+			},
+		},
+		{
+			name: "created with CreateAccessToken",
+			token: func(t *testing.T) string {
+				tokenString, err := CreateAccessToken(Principal{Username: "client-1", Role: RoleClient}, "client@example.com")
+
+				if err != nil {
+					t.Fatalf("failed to create token: %v", err)
+				}
+
+				return tokenString
+			},
+		},
+		{
+			name: "expired inside the leeway",
+			token: func(t *testing.T) string {
+				claims := validClaims(now.Add(-time.Hour))
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+		},
+		{
+			name: "without iat",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.IssuedAt = nil
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				claims := validClaims(now.Add(-2 * time.Hour))
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "without expiration",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.ExpiresAt = nil
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "not valid yet",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "tampered payload",
+			token: func(t *testing.T) string {
+				return tamperPayload(t, sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(now)))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte("another-secret"), validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with another algorithm",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS512, []byte(testSecret), validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "another issuer",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.Issuer = "someone-else"
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "another audience",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.Audience = jwt.ClaimStrings{"another-api"}
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "without role",
+			token: func(t *testing.T) string {
+				claims := validClaims(now)
+				claims.Role = ""
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed",
+			token: func(t *testing.T) string {
+				return "not.a.token"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token(t))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got claims %+v", claims)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if claims.Subject != "client-1" || claims.Role != RoleClient {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokensWithoutSecret(t *testing.T) {
+	tokenString := sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(time.Now()))
+
+	t.Setenv("SECRET", "")
+
+	if _, err := ParseToken(tokenString); !errors.Is(err, ErrMissingSecret) {
+		t.Errorf("ParseToken: expected ErrMissingSecret, got %v", err)
+	}
+
+	if _, err := CreateAccessToken(Principal{Username: "client-1", Role: RoleClient}, ""); !errors.Is(err, ErrMissingSecret) {
+		t.Errorf("CreateAccessToken: expected ErrMissingSecret, got %v", err)
+	}
+}
+
+func pemPrivateKey(t *testing.T, key crypto.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func pemPublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	tokenString, err := token.SignedString(key)
+
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return tokenString
+}
+
+func TestAsymmetricTokens(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	_, unknownKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	// the RSA key is being rotated out, so only its public key is left
+	t.Setenv("SECRET", "")
+	t.Setenv("JWT_SIGNING_KEY", pemPrivateKey(t, edKey))
+	t.Setenv("JWT_SIGNING_KEY_ID", "new")
+	t.Setenv("JWT_PUBLIC_KEYS", `{"old": `+strconv.Quote(pemPublicKey(t, &oldKey.PublicKey))+`}`)
+
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{
+			name: "created with CreateAccessToken",
+			token: func(t *testing.T) string {
+				tokenString, err := CreateAccessToken(Principal{Username: "client-1", Role: RoleClient}, "client@example.com")
+
+				if err != nil {
+					t.Fatalf("failed to create token: %v", err)
+				}
+
+				return tokenString
+			},
+		},
+		{
+			name: "signed with the old key",
+			token: func(t *testing.T) string {
+				return signWithKid(t, jwt.SigningMethodRS256, "old", oldKey, validClaims(now))
+			},
+		},
+		{
+			name: "unknown key id",
+			token: func(t *testing.T) string {
+				return signWithKid(t, jwt.SigningMethodEdDSA, "unknown", unknownKey, validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with another key",
+			token: func(t *testing.T) string {
+				return signWithKid(t, jwt.SigningMethodEdDSA, "new", unknownKey, validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "algorithm of another key",
+			token: func(t *testing.T) string {
+				return signWithKid(t, jwt.SigningMethodRS256, "new", oldKey, validClaims(now))
+			},
+			wantErr: true,
+		},
+		{
+			name: "HS256 without the secret",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(now))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token(t))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got claims %+v", claims)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if claims.Subject != "client-1" || claims.Role != RoleClient {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+
+	t.Run("HS256 with the secret", func(t *testing.T) {
+		t.Setenv("SECRET", testSecret)
+
+		tokenString := sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(now))
+
+		if claims, err := ParseToken(tokenString); err == nil {
+			t.Fatalf("expected HS256 to be rejected once the keys are configured, got claims %+v", claims)
+		}
+
+		// during the migration the old tokens are still accepted
+		t.Setenv("JWT_HS256_UNTIL", now.Add(time.Hour).Format(time.RFC3339))
+
+		if _, err := ParseToken(tokenString); err != nil {
+			t.Fatalf("unexpected error during the migration: %v", err)
+		}
+
+		t.Setenv("JWT_HS256_UNTIL", now.Add(-time.Hour).Format(time.RFC3339))
+
+		if claims, err := ParseToken(tokenString); err == nil {
+			t.Fatalf("expected HS256 to be rejected after the migration, got claims %+v", claims)
+		}
+	})
+
+	t.Run("public key set", func(t *testing.T) {
+		keySet, err := PublicKeySet()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(keySet.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %+v", keySet.Keys)
+		}
+
+		newKey, oldKey := keySet.Keys[0], keySet.Keys[1]
+
+		if newKey.KeyId != "new" || newKey.KeyType != "OKP" || newKey.Algorithm != "EdDSA" || newKey.X == "" {
+			t.Errorf("unexpected key: %+v", newKey)
+		}
+
+		if oldKey.KeyId != "old" || oldKey.KeyType != "RSA" || oldKey.Algorithm != "RS256" || oldKey.Exponent != "AQAB" {
+			t.Errorf("unexpected key: %+v", oldKey)
+		}
+	})
+}
+
+func TestParsePrincipalWithoutIssuedAt(t *testing.T) {
+	t.Setenv("SECRET", testSecret)
+
+	claims := validClaims(time.Now())
+	claims.IssuedAt = nil
+
+	// a validly signed token without iat must be rejected, not panic
+	_, err := ParsePrincipal(sign(t, jwt.SigningMethodHS256, []byte(testSecret), claims))
+
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected %v, got %v", ErrInvalidToken, err)
+	}
+}
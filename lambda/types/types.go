@@ -1,17 +1,12 @@
 package types
 
 import (
-	"fmt"
-	"os"
-	"strings"
+	"encoding/json"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var SECRET = os.Getenv("SECRET")
-
 const DATE_YYYY_MM_DD = "2006-01-02"
 
 type Entity struct {
@@ -29,12 +24,23 @@ type User struct {
 	Password  string    `dynamodbav:"password" json:"-"  validator:"required,min=8"`
 	CreatedAt time.Time `dynamodbav:"createdAt" json:"createdAt" validator:"required"`
 
+	// disabled by an administrator, the user can't log in anymore
+	Disabled       bool   `dynamodbav:"disabled" json:"disabled"`
+	DisabledReason string `dynamodbav:"disabledReason,omitempty" json:"disabledReason,omitempty"`
+
 	// a single user can have many coupons, and a single coupon can be owned by many users
 	// also, to keep a history of the coupons that a user has redeemed, we won't delete the registers. Just update the original item
 	//UserCoupons       []UserCoupon       `dynamodbav:"userCoupons" json:"userCoupons" validator:"required_with=ClientDetails"` // for storing many-to-many relationship
 	//RegisteredCoupons []RegisteredCoupon `dynamodbav:"registeredCoupons" json:"registeredCoupons" validator:"omitempty,required_with=EnterpriseDetails"`
 }
 
+// states of the email of a client. The clients registered before the verification existed have
+// an empty state, and they are treated as verified
+const (
+	EmailPending  = "pending"
+	EmailVerified = "verified"
+)
+
 type Client struct {
 	User
 	FirstName   string `dynamodbav:"firstName" json:"firstName"`
@@ -42,6 +48,31 @@ type Client struct {
 	Address     string `dynamodbav:"address" json:"address"`
 	PhoneNumber string `dynamodbav:"phoneNumber" json:"phoneNumber"`
 	DUI         string `dynamodbav:"dui" json:"dui"`
+	// unverified clients can't buy coupons
+	EmailState string `dynamodbav:"emailState,omitempty" json:"emailState"`
+}
+
+func (c Client) IsEmailVerified() bool {
+	return c.EmailState != EmailPending
+}
+
+// fields of a user to change, nil for the ones that stay the same. Only these attributes are written,
+// so two updates of different fields can't undo each other
+type UserUpdate struct {
+	Password       *string // already hashed
+	Disabled       *bool
+	DisabledReason *string
+
+	// only for the clients
+	FirstName   *string
+	LastName    *string
+	Address     *string
+	PhoneNumber *string
+	Email       *string
+	EmailState  *string
+
+	// the update is only applied while the email is still this one, ErrConflict otherwise
+	IfEmail *string
 }
 
 type Enterprise struct {
@@ -52,6 +83,15 @@ type Enterprise struct {
 	Location            string `dynamodbav:"location" json:"location"`
 	PhoneNumber         string `dynamodbav:"phoneNumber" json:"phoneNumber"`
 	Category            string `dynamodbav:"category" json:"category"` // the category of the enterprise (restaurant, gym, etc)
+	// deactivated enterprises can't publish new coupons or register employees
+	Deactivated bool `dynamodbav:"deactivated" json:"deactivated"`
+}
+
+// reservation of an enterprise code, so two enterprises can't share the same one
+type EnterpriseCodeReservation struct {
+	Entity
+	Code         string `dynamodbav:"id" json:"code"`
+	EnterpriseId string `dynamodbav:"enterpriseId" json:"enterpriseId"`
 }
 
 type Administrator struct {
@@ -88,12 +128,20 @@ type Coupon struct {
 	ValidFrom    time.Time `dynamodbav:"validFrom" json:"validFrom" validate:"required"`
 	ValidUntil   time.Time `dynamodbav:"validUntil" json:"validUntil" validate:"required,gt"` // greater than now
 
-	// Available quantity of coupons. -1 if there is no limit in the amount of coupons
-	AvailableCoupons int    `dynamodbav:"availableCoupons" json:"availableCoupons" validate:"required,ne=0"`
+	// zero for the coupons created before it was stored
+	CreatedAt time.Time `dynamodbav:"createdAt" json:"createdAt"`
+
+	// Available quantity of coupons. UnlimitedCoupons (-1) if there is no limit in the amount of coupons
+	AvailableCoupons int    `dynamodbav:"availableCoupons" json:"availableCoupons" validate:"required,gte=-1,ne=0"`
+	SoldCoupons      int    `dynamodbav:"soldCoupons" json:"soldCoupons"` // only modified when a coupon is bought
 	OfferDesc        string `dynamodbav:"offerDesc" json:"offerDesc"`
 
-	// TODO: could use this one, but not sure yet
-	// CouponState      string `dynamodbav:"couponState" json:"couponState" validate:"required,oneof=active inactive expired pending rejected"`
+	// how many coupons each client can buy. 0 if there is no limit
+	MaxPerClient int `dynamodbav:"maxPerClient" json:"maxPerClient" validate:"gte=0"`
+
+	// only active coupons are shown to the clients. Every change of state is kept in the history
+	CouponState  string             `dynamodbav:"couponState" json:"couponState" validate:"required,oneof=active inactive expired pending rejected"`
+	StateHistory []CouponTransition `dynamodbav:"stateHistory" json:"stateHistory,omitempty"`
 
 	// Can have any structure for other properties defined in the UI
 	// the idea is that is a nested details object
@@ -101,6 +149,75 @@ type Coupon struct {
 	Category     string `dynamodbav:"category" json:"category"`
 }
 
+// value of AvailableCoupons for the coupons without a stock. They are never sold out,
+// and only their SoldCoupons count changes when they are bought
+const UnlimitedCoupons = -1
+
+func (c Coupon) IsUnlimited() bool {
+	return c.AvailableCoupons == UnlimitedCoupons
+}
+
+// the coupons are sent with an "unlimited" flag, so the UI doesn't have to know about the -1
+func (c Coupon) MarshalJSON() ([]byte, error) {
+	// the alias has the same fields but not this method, so it doesn't recurse
+	type coupon Coupon
+
+	return json.Marshal(struct {
+		coupon
+		Unlimited bool `json:"unlimited"`
+	}{
+		coupon:    coupon(c),
+		Unlimited: c.IsUnlimited(),
+	})
+}
+
+// how much cheaper the offer price is, from 0 to 100
+func (c Coupon) DiscountPercent() float64 {
+	if c.RegularPrice <= 0 {
+		return 0
+	}
+
+	return (1 - float64(c.OfferPrice)/float64(c.RegularPrice)) * 100
+}
+
+// the clients can see and buy the coupon: it is active, and today is inside its validity window.
+// Scheduled coupons (ValidFrom in the future) are hidden until they start
+func (c Coupon) IsOnSale(now time.Time) bool {
+	return c.CouponState == CouponStateActive && !c.ValidFrom.After(now) && c.ValidUntil.After(now)
+}
+
+// editable fields of a coupon. The nil fields are not changed, and the enterprise, the start date,
+// the state and the counters can't be changed this way
+type CouponUpdate struct {
+	Title        *string
+	RegularPrice *float32
+	OfferPrice   *float32
+	ValidUntil   *time.Time
+	OfferDesc    *string
+	MaxPerClient *int
+}
+
+// lifecycle of a coupon:
+// pending -> active | rejected, active <-> inactive, active | inactive -> expired
+const (
+	CouponStatePending  = "pending"  // submitted by the enterprise, waiting for an administrator
+	CouponStateActive   = "active"   // approved, the clients can see it and buy it
+	CouponStateInactive = "inactive" // paused, it can be activated again
+	CouponStateExpired  = "expired"  // the validity date already passed
+	CouponStateRejected = "rejected" // not approved by an administrator
+)
+
+// username used for the transitions that happen automatically (like expiring a coupon)
+const SystemActor = "system"
+
+type CouponTransition struct {
+	From   string    `dynamodbav:"from" json:"from"`
+	To     string    `dynamodbav:"to" json:"to"`
+	By     string    `dynamodbav:"by" json:"by"` // username of who made the change
+	At     time.Time `dynamodbav:"at" json:"at"`
+	Reason string    `dynamodbav:"reason,omitempty" json:"reason,omitempty"`
+}
+
 // struct for a generated coupon (the one that user buys, not the general offer)
 type GeneratedOffer struct {
 	Entity
@@ -109,9 +226,15 @@ type GeneratedOffer struct {
 	OfferPrice     float32   `dynamodbav:"offerPrice" json:"offerPrice"`
 	RegularPrice   float32   `dynamodbav:"regularPrice" json:"regularPrice"`
 	UserId         string    `dynamodbav:"userId" json:"userId"`
+	EnterpriseId   string    `dynamodbav:"enterpriseCode" json:"enterpriseCode"` // enterprise of the coupon, for the sales reports
 	GeneratedAt    time.Time `dynamodbav:"generatedAt" json:"generatedAt"`
 	ExpirationDate time.Time `dynamodbav:"validUntil" json:"validUntil"`
 	Redeemed       bool      `dynamodbav:"redeemed" json:"redeemed"`
+
+	// only present once the offer is redeemed
+	RedeemedAt           *time.Time `dynamodbav:"redeemedAt,omitempty" json:"redeemedAt,omitempty"`
+	RedeemedBy           string     `dynamodbav:"redeemedBy,omitempty" json:"redeemedBy,omitempty"` // username of the employee
+	RedeemedAtEnterprise string     `dynamodbav:"redeemedAtEnterprise,omitempty" json:"redeemedAtEnterprise,omitempty"`
 }
 
 type CouponRange struct {
@@ -121,67 +244,107 @@ type CouponRange struct {
 
 type OfferRange struct {
 	Offers []GeneratedOffer `json:"offers"`
+	Next   *string          `json:"next"`
 }
 
-func ValidatePassword(hashedPassword, plainTextPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainTextPassword))
-	return err == nil
-}
-
-func CreateTokenClient(c Client) string {
-	now := time.Now()
-
-	// valid for 6 hours
-	validUntil := now.Add(time.Hour * 6).Unix()
-
-	claims := jwt.MapClaims{
-		"username": c.Username,
-		"email":    c.Email,
-		"role":     "client",
-		"expires":  validUntil,
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims, nil)
-
-	// !STORE THE SECRET IN A MORE SECURE PLACE
-	secret := []byte(SECRET)
-
-	tokenString, err := token.SignedString(secret)
+// status filters for the purchase history of a client
+const (
+	OfferStatusActive   = "active"   // not redeemed and still valid
+	OfferStatusRedeemed = "redeemed" // already used in the enterprise
+	OfferStatusExpired  = "expired"  // not redeemed, but it can't be used anymore
+)
 
-	if err != nil {
-		return ""
-	}
+// parameters for querying the offers bought by a client
+type OfferQuery struct {
+	Status    string  // one of the OfferStatus constants, empty for all the offers
+	Ascending bool    // oldest offers first. By default, the newest ones are returned first
+	Next      *string // pagination token
+	Limit     int32
+}
 
-	return tokenString
+// ************************************************************
+// IDEMPOTENCY ENTITIES
+// ************************************************************
 
+type IdempotencyRecord struct {
+	Entity
+	Key          string    `dynamodbav:"id"` // <caller>#<Idempotency-Key>
+	RequestHash  string    `dynamodbav:"requestHash"`
+	Completed    bool      `dynamodbav:"completed"` // false while the first request is still being processed
+	StatusCode   int       `dynamodbav:"statusCode"`
+	ResponseBody string    `dynamodbav:"responseBody"`
+	CreatedAt    time.Time `dynamodbav:"createdAt"`
+	ExpiresAt    int64     `dynamodbav:"ttl"` // unix seconds, the table deletes the record after this date
 }
 
-func CreateTokenEmployee(e Employee) string {
-	now := time.Now()
-
-	// valid for 6 hours
-	validUntil := now.Add(time.Hour * 6).Unix()
+// ************************************************************
+// SESSION ENTITIES
+// ************************************************************
 
-	claims := jwt.MapClaims{
-		"username": e.Username,
-		"email":    e.Email,
-		"role":     "employee",
-		"expires":  validUntil,
-	}
+// refresh tokens are saved hashed, the plain token is only known by the client
+type RefreshToken struct {
+	Entity
+	Hash         string    `dynamodbav:"id"`
+	Username     string    `dynamodbav:"username"`
+	Role         string    `dynamodbav:"role"`
+	EnterpriseId string    `dynamodbav:"enterpriseId,omitempty"`
+	Email        string    `dynamodbav:"email,omitempty"`
+	CreatedAt    time.Time `dynamodbav:"createdAt"`
+	ExpiresAt    int64     `dynamodbav:"ttl"` // unix seconds
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims, nil)
+// access token in the deny-list, kept until the token expires
+type RevokedToken struct {
+	Entity
+	TokenId   string `dynamodbav:"id"`
+	ExpiresAt int64  `dynamodbav:"ttl"`
+}
 
-	// !STORE THE SECRET IN A MORE SECURE PLACE
-	secret := []byte(SECRET)
+// every token of the user issued before RevokedAt is rejected
+type SessionRevocation struct {
+	Entity
+	Id        string    `dynamodbav:"id"` // <role>#<username>, the usernames are only unique for each role
+	RevokedAt time.Time `dynamodbav:"revokedAt"`
+	ExpiresAt int64     `dynamodbav:"ttl"`
+}
 
-	tokenString, err := token.SignedString(secret)
+// token sent by email, saved with the id <purpose>#<hash>
+type OneTimeToken struct {
+	Entity
+	Id        string    `dynamodbav:"id"`
+	Purpose   string    `dynamodbav:"purpose"`
+	Username  string    `dynamodbav:"username"`
+	Role      string    `dynamodbav:"role"`
+	Email     string    `dynamodbav:"email"`
+	CreatedAt time.Time `dynamodbav:"createdAt"`
+	ExpiresAt int64     `dynamodbav:"ttl"` // unix seconds
+}
 
-	if err != nil {
-		return ""
-	}
+// failed logins of a user ("user#<role>#<username>") or an IP address ("ip#<address>").
+// The logins are counted before checking the password, so the ones in progress are failures too
+type LoginAttempts struct {
+	Entity
+	Key           string    `dynamodbav:"id"`
+	Failures      int       `dynamodbav:"failures"`
+	LastAttemptAt time.Time `dynamodbav:"lastAttemptAt"`
+	ExpiresAt     int64     `dynamodbav:"ttl"`
+
+	// set by the attempt that reached the threshold: the failures counted at that moment,
+	// and the end of the lockout (unix seconds)
+	LockedFailures int   `dynamodbav:"lockedFailures,omitempty"`
+	LockedUntil    int64 `dynamodbav:"lockedUntil,omitempty"`
+}
 
-	return tokenString
+// tokens returned when a session starts or is refreshed
+type SessionTokens struct {
+	AuthToken    string `json:"authToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // seconds until the auth token expires
+}
 
+func ValidatePassword(hashedPassword, plainTextPassword string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainTextPassword))
+	return err == nil
 }
 
 func HashPassword(password string) (string, error) {
@@ -190,65 +353,3 @@ func HashPassword(password string) (string, error) {
 
 	return password, nil
 }
-
-func ExtractTokenFromHeaders(headers map[string]string) string {
-	authHeader, ok := headers["Authorization"]
-
-	if !ok {
-		return ""
-	}
-
-	splitToken := strings.Split(authHeader, "Bearer ")
-
-	if len(splitToken) != 2 {
-		return ""
-	}
-
-	return splitToken[1]
-}
-
-func ParseToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		secret := []byte(os.Getenv("SECRET"))
-		return secret, nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse JWT token: %w", err)
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid JWT token")
-	}
-
-	// type assertion
-	claims, ok := token.Claims.(jwt.MapClaims)
-
-	if !ok {
-		return nil, fmt.Errorf("failed to parse JWT claims")
-	}
-
-	return claims, nil
-}
-
-func GetClientAuthFromHeader(headers map[string]string) (Client, error) {
-	tokenString := ExtractTokenFromHeaders(headers)
-
-	if tokenString == "" {
-		return Client{}, nil
-	}
-
-	claims, err := ParseToken(tokenString)
-
-	if err != nil {
-		return Client{}, err
-	}
-
-	username := claims["username"].(string)
-
-	return Client{
-		User: User{
-			Username: username,
-		},
-	}, nil
-}
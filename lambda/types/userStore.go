@@ -19,6 +19,16 @@ type UserStore interface {
 	GetAdministrator(context.Context, string) (Administrator, error)
 	GetEmployee(context.Context, string) (Employee, error)
 
-	// TODO: Implement these methods
-	//UpdateClient(context.Context, string, Client) error
+	// Partial updates, see UserUpdate. Returns ErrNotFound if the user doesn't exist
+	UpdateClient(context.Context, string, UserUpdate) (Client, error)
+	UpdateEmployee(context.Context, string, UserUpdate) (Employee, error)
+
+	// Enterprises
+	// returns ErrConflict if the code is already used by another enterprise
+	ReserveEnterpriseCode(context.Context, string, string) error
+	ListEnterprises(context.Context, *string, int32) (EnterpriseRange, error)
+
+	// Employees of an enterprise
+	GetEnterpriseEmployees(context.Context, string, *string, int32) (EmployeeRange, error)
+	DeleteEmployee(context.Context, string) error
 }